@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// bytesDownloaded counts the bytes received by every download of a run,
+// asset and checksums files alike.
+var bytesDownloaded atomic.Int64
+
+// formatBytes formats n with the binary units --limit-rate takes, e.g.
+// 12.3 MiB.
+func formatBytes(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, prefix := float64(n)/unit, "KMGT"
+	for i := 0; ; i++ {
+		if v < unit || i == len(prefix)-1 {
+			return fmt.Sprintf("%.1f %ciB", v, prefix[i])
+		}
+		v /= unit
+	}
+}
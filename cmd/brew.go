@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// runBrew runs "brew <args>" and returns an error carrying its output if
+// brew fails. ok is false, with no error, when brew isn't installed.
+func runBrew(args ...string) (ok bool, err error) {
+	brew, err := exec.LookPath("brew")
+	if err != nil {
+		return false, nil
+	}
+
+	var out bytes.Buffer
+	c := exec.Command(brew, args...)
+	c.Stdout = &out
+	c.Stderr = &out
+	if err := c.Run(); err != nil {
+		return true, fmt.Errorf("brew %s failed: %w\n%s", strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return true, nil
+}
+
+// tapFormulaRegex matches the path of a formula in a tapped repository,
+// capturing the tap's user, its name without "homebrew-" and the formula.
+var tapFormulaRegex = regexp.MustCompile(`/Taps/([^/]+)/homebrew-([^/]+)/(?:.+/)?([^/]+)\.rb$`)
+
+// auditDisabledPattern is how brew refuses to audit a formula by path,
+// which recent versions only allow for formulas named in a tap.
+const auditDisabledPattern = "brew audit [path ...]` is disabled"
+
+// auditFormula runs "brew audit --formula" on a written formula, by its
+// name when it is in a tap. When the audit fails and --backup is set, the
+// formula is restored from its backup. A brew that refuses to audit by
+// path is noted and the audit skipped, rather than failing the bump.
+func auditFormula(path string) error {
+	target := path
+	if abs, err := filepath.Abs(path); err == nil {
+		if m := tapFormulaRegex.FindStringSubmatch(filepath.ToSlash(abs)); m != nil {
+			target = m[1] + "/" + m[2] + "/" + m[3]
+		}
+	}
+	ok, err := runBrew("audit", "--formula", target)
+	if !ok {
+		logf("brew not found, skipping audit of %s\n", path)
+		return nil
+	}
+	if err == nil {
+		logf("brew audit passed for %s\n", path)
+		return nil
+	}
+	if strings.Contains(err.Error(), auditDisabledPattern) {
+		logf("brew audit unsupported for path %s (brew only audits formulas in a tap), skipping audit\n", path)
+		return nil
+	}
+
+	if backup {
+		if rerr := restoreBackup(path); rerr != nil {
+			return fmt.Errorf("%w\nfailed to restore %s: %v", err, path, rerr)
+		}
+		logf("Restored %s from backup\n", path)
+	}
+	return err
+}
+
+// testFormula runs "brew test" on a written formula. When the test fails,
+// the formula is put back to original, so a broken bump is never left in
+// place.
+func testFormula(path, original string) error {
+	ok, err := runBrew("test", path)
+	if !ok {
+		logf("brew not found, skipping test of %s\n", path)
+		return nil
+	}
+	if err == nil {
+		logf("brew test passed for %s\n", path)
+		return nil
+	}
+
+	if rerr := os.WriteFile(path, []byte(original), 0o644); rerr != nil {
+		return fmt.Errorf("%w\nfailed to restore %s: %v", err, path, rerr)
+	}
+	logf("Restored the original %s\n", path)
+	return err
+}
+
+// writeBackup saves the current content of path to path.bak.
+func writeBackup(path, content string) error {
+	if err := os.WriteFile(path+".bak", []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// restoreBackup puts path.bak back in place of path.
+func restoreBackup(path string) error {
+	b, err := os.ReadFile(path + ".bak")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
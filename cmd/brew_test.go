@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeBrew puts a brew on PATH that records its arguments and exits with
+// the status, and prints the output, given for its subcommand.
+func fakeBrew(t *testing.T, audit, test string) (argsFile string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake brew is a shell script")
+	}
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	script := `#!/bin/sh
+echo "$@" >> "` + argsFile + `"
+case "$1" in
+audit) ` + audit + ` ;;
+test) ` + test + ` ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "brew"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsFile
+}
+
+const (
+	brewPass     = "exit 0"
+	brewFail     = `echo "sbomasm: 1 problem"; exit 1`
+	brewDisabled = "echo 'Error: Calling `brew audit [path ...]` is disabled! Use `brew audit [name ...]` instead.'; exit 1"
+)
+
+func TestAuditAndTest(t *testing.T) {
+	tests := []struct {
+		name        string
+		audit, test string
+		args        []string
+		wantErr     string
+		wantLog     string
+		restored    bool
+	}{
+		{name: "audit passes", audit: brewPass, args: []string{"--audit"}, wantLog: "brew audit passed"},
+		{name: "audit fails", audit: brewFail, args: []string{"--audit", "--backup"}, wantErr: "1 problem", restored: true},
+		{name: "audit by path disabled", audit: brewDisabled, args: []string{"--audit"}, wantLog: "brew audit unsupported for path"},
+		{name: "test passes", test: brewPass, args: []string{"--run-test"}, wantLog: "brew test passed"},
+		{name: "test fails", test: brewFail, args: []string{"--run-test"}, wantErr: "1 problem", restored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeBrew(t, or(tt.audit, brewPass), or(tt.test, brewPass))
+			serveAssets(t, releaseAssets("v1.0.5"))
+			path := copyExample(t, "sbomasm.rb")
+			orig, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			log, err := runBrewup(t, append([]string{"-f", path, "-v", "v1.0.5"}, tt.args...)...)
+			b, _ := os.ReadFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(log, "Successfully updated") {
+					t.Errorf("reported success for a failed bump:\n%s", log)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantLog != "" && !strings.Contains(log, tt.wantLog) {
+				t.Errorf("log has no %q:\n%s", tt.wantLog, log)
+			}
+			if tt.wantErr == "" && !strings.Contains(log, "Successfully updated") {
+				t.Errorf("no success message:\n%s", log)
+			}
+			if restored := string(b) == string(orig); restored != tt.restored {
+				t.Errorf("formula restored = %v, want %v", restored, tt.restored)
+			}
+		})
+	}
+}
+
+func TestAuditTapFormulaByName(t *testing.T) {
+	argsFile := fakeBrew(t, brewPass, brewPass)
+	serveAssets(t, releaseAssets("v1.0.5"))
+	src := copyExample(t, "sbomasm.rb")
+	b, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "Library", "Taps", "interlynk-io", "homebrew-tap", "Formula")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "sbomasm.rb")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runBrewup(t, "-f", path, "-v", "v1.0.5", "--audit"); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(args)); got != "audit --formula interlynk-io/tap/sbomasm" {
+		t.Errorf("brew ran with %q, want the formula's tap name", got)
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	osBlockRegex       = regexp.MustCompile(`^(\s*)on_(macos|linux) do\s*$`)
+	platformBlockRegex = regexp.MustCompile(`^(\s*)if Hardware::CPU\.`)
+	managedLineRegex   = regexp.MustCompile(`^\s*(url|sha256|sha384|sha512|blake3) "`)
+)
+
+// canonicalize normalizes the platform blocks brewup manages: inside each
+// on_macos/on_linux block, the "if Hardware::CPU..." blocks are ordered like
+// the platform matrix, and their url and checksum lines are indented one
+// level deeper than the if. Anything outside those blocks, and any other
+// line inside them, is left as it is.
+func canonicalize(content string, pr project) string {
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		m := osBlockRegex.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		end := blockEnd(lines, i, m[1])
+		if end < 0 {
+			continue
+		}
+		canonicalizeOSBlock(lines[i+1:end], pr)
+		i = end
+	}
+	return strings.Join(lines, "\n")
+}
+
+// canonicalizeOSBlock reorders and reindents the platform blocks in body,
+// the lines between an on_* line and its end, in place.
+func canonicalizeOSBlock(body []string, pr project) {
+	type block struct {
+		lines []string
+		rank  int
+	}
+
+	var blocks []block
+	var starts []int
+	for i := 0; i < len(body); i++ {
+		m := platformBlockRegex.FindStringSubmatch(body[i])
+		if m == nil {
+			continue
+		}
+		end := blockEnd(body, i, m[1])
+		if end < 0 {
+			return
+		}
+
+		lines := append([]string(nil), body[i:end+1]...)
+		for j, l := range lines {
+			if managedLineRegex.MatchString(l) {
+				lines[j] = m[1] + "  " + strings.TrimSpace(l)
+			}
+		}
+		blocks = append(blocks, block{lines: lines, rank: platformRank(lines, pr)})
+		starts = append(starts, i)
+		i = end
+	}
+
+	// Reorder only when every block could be identified and they are
+	// contiguous apart from blank lines, so nothing between them moves.
+	ordered := append([]block(nil), blocks...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].rank < ordered[j].rank })
+	for _, b := range ordered {
+		if b.rank == len(platforms) {
+			ordered = blocks
+			break
+		}
+	}
+	for i := 1; i < len(blocks); i++ {
+		for _, l := range body[starts[i-1]+len(blocks[i-1].lines) : starts[i]] {
+			if strings.TrimSpace(l) != "" {
+				ordered = blocks
+			}
+		}
+	}
+
+	// Lay the blocks out again in the slots the originals occupied,
+	// keeping the blank lines between them.
+	var out []string
+	pos := 0
+	for i, b := range ordered {
+		out = append(out, body[pos:starts[i]]...)
+		out = append(out, b.lines...)
+		pos = starts[i] + len(blocks[i].lines)
+	}
+	out = append(out, body[pos:]...)
+	copy(body, out)
+}
+
+// pruneBlock removes the "if Hardware::CPU..." block whose url references
+// p's binary. content is returned unchanged if there is no such block.
+func pruneBlock(content string, pr project, p platform) string {
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		m := platformBlockRegex.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		end := blockEnd(lines, i, m[1])
+		if end < 0 {
+			break
+		}
+		if platformRank(lines[i:end+1], pr) == indexOfPlatform(p) {
+			// Drop the block along with one blank line after it.
+			if end+1 < len(lines) && strings.TrimSpace(lines[end+1]) == "" {
+				end++
+			}
+			lines = append(lines[:i], lines[end+1:]...)
+			break
+		}
+		i = end
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indexOfPlatform(p platform) int {
+	for i, known := range platforms {
+		if known == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// platformRank returns the position in the platform matrix of the platform
+// whose binary a block's url references, or len(platforms) if none does.
+func platformRank(lines []string, pr project) int {
+	for _, l := range lines {
+		if !managedLineRegex.MatchString(l) || !strings.Contains(l, "url ") {
+			continue
+		}
+		for i, p := range platforms {
+			if strings.Contains(l, "/"+p.binaryName(pr.repo)+`"`) {
+				return i
+			}
+		}
+	}
+	return len(platforms)
+}
+
+// blockEnd returns the index of the "end" line closing the block opened at
+// lines[start] with the given indentation, or -1 if there is none.
+func blockEnd(lines []string, start int, indent string) int {
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], " \t") == indent+"end" {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+// checkFormula downloads the binaries a formula currently points at and
+// verifies that they match the pinned checksums.
+func checkFormula(path string, a hashAlgo) (formulaSummary, error) {
+	content, pr, err := readFormula(path)
+	if err != nil {
+		return formulaSummary{}, err
+	}
+	summary := formulaSummary{
+		Repo:       pr.String(),
+		OldVersion: formulaVersion(content),
+	}
+
+	logf("Checking %s:\n", path)
+	if isSourceFormula(content) {
+		return checkSource(content, a, summary)
+	}
+	mismatches := 0
+	for _, p := range platformOrder() {
+		if ignored[p] {
+			logf("Checksum (%s): ignored, skipping\n", p)
+			summary.Platforms = append(summary.Platforms, platformSummary{Platform: p.String(), Status: "skipped"})
+			continue
+		}
+
+		url, want, ok := currentAsset(content, pr, p, a)
+		if assetGlob != "" {
+			// Asset names don't follow <repo>-<os>-<arch>; find the url
+			// with the glob, as updates do.
+			if u, err := formulaAssetURL(content, pr, p); err == nil {
+				url, want, ok = u, checksumAt(content, u, a), true
+			}
+		}
+		if !ok {
+			logf("Checksum (%s): no url block found, skipping\n", p)
+			logf("%s", noMatchSnippet(path, content, pr, p, a))
+			summary.Platforms = append(summary.Platforms, platformSummary{Platform: p.String(), Status: "missing"})
+			continue
+		}
+
+		opts := downloadOptionsFor(p)
+		var received int64
+		opts.received = &received
+		sums, err := calculateChecksums(url, append([]hashAlgo{a}, extraAlgos...), opts)
+		if err != nil {
+			return summary, fmt.Errorf("failed to calculate checksum for %s: %w", p.binaryName(pr.repo), err)
+		}
+		got := sums[0]
+		if a.isEmptyInput(got) {
+			return summary, emptyChecksumError(p, url, a)
+		}
+		for i, x := range append([]hashAlgo{a}, extraAlgos...) {
+			if err := verifyRekorEntry(sums[i], x, logOut); err != nil {
+				return summary, fmt.Errorf("%s: %w", p.binaryName(pr.repo), err)
+			}
+		}
+
+		ps := platformSummary{Platform: p.String(), URL: redactURL(url), OldChecksum: want, NewChecksum: got, Status: "ok", BytesDownloaded: received}
+		if got != want {
+			mismatches++
+			ps.Status = "mismatch"
+			logf("Checksum (%s): MISMATCH formula has %s, asset has %s\n", p, want, got)
+		} else {
+			logf("Checksum (%s): OK\n", p)
+		}
+		for i, x := range extraAlgos {
+			old, ok := blockChecksum(content, url, x)
+			if !ok {
+				return summary, fmt.Errorf("the url block of %s has no %s line, though the config file's algorithms list it", p, x.name)
+			}
+			ps.OtherChecksums = append(ps.OtherChecksums, checksumSummary{Algorithm: x.name, OldChecksum: old, NewChecksum: sums[i+1]})
+			if old != sums[i+1] {
+				mismatches++
+				ps.Status = "mismatch"
+				logf("Checksum (%s, %s): MISMATCH formula has %s, asset has %s\n", p, x.name, old, sums[i+1])
+			} else {
+				logf("Checksum (%s, %s): OK\n", p, x.name)
+			}
+		}
+		if reportBandwidth && verbose {
+			logf("Downloaded (%s): %s\n", p, formatBytes(received))
+		}
+		summary.Platforms = append(summary.Platforms, ps)
+	}
+
+	if mismatches > 0 {
+		return summary, fmt.Errorf("%d checksum(s) do not match", mismatches)
+	}
+	summary.Status = "ok"
+	return summary, nil
+}
+
+// checkSource verifies the checksum of a source formula's archive.
+func checkSource(content string, a hashAlgo, summary formulaSummary) (formulaSummary, error) {
+	summary.OldVersion = sourceVersion(content)
+	url := sourceURLRegex.FindStringSubmatch(content)[1]
+	want := sourceChecksum(content, url, a)
+
+	got, err := calculateChecksum(url, a, defaultDownloadOptions())
+	if err != nil {
+		return summary, fmt.Errorf("failed to calculate checksum for %s: %w", redactURL(url), err)
+	}
+	if err := verifyRekorEntry(got, a, logOut); err != nil {
+		return summary, fmt.Errorf("%s: %w", redactURL(url), err)
+	}
+
+	ps := platformSummary{Platform: "source", URL: redactURL(url), OldChecksum: want, NewChecksum: got, Status: "ok"}
+	summary.Platforms = append(summary.Platforms, ps)
+	if got != want {
+		summary.Platforms[0].Status = "mismatch"
+		logf("Checksum (source): MISMATCH formula has %s, archive has %s\n", want, got)
+		return summary, fmt.Errorf("1 checksum(s) do not match")
+	}
+	logf("Checksum (source): OK\n")
+	summary.Status = "ok"
+	return summary, nil
+}
+
+func emptyChecksumError(p platform, url string, a hashAlgo) error {
+	return fmt.Errorf("checksum for %s is the %s of empty input, the download from %s was empty", p, a.name, redactURL(url))
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checksumManifest maps file names to checksums, as listed in a release's
+// checksums file (the output of sha256sum and friends).
+type checksumManifest map[string]string
+
+// expandChecksumsURL fills the {org}, {repo} and {version} placeholders of
+// a --checksums-url.
+func expandChecksumsURL(tmpl string, pr project, tag string) string {
+	return strings.NewReplacer("{org}", pr.org, "{repo}", pr.repo, "{version}", tag).Replace(tmpl)
+}
+
+// defaultChecksumsCandidates are the checksums file names tried with
+// --assume-checksums-file, in order.
+var defaultChecksumsCandidates = []string{"checksums.txt", "SHA256SUMS", "{repo}_{version}_checksums.txt", "checksums_sha256.txt"}
+
+// discoverChecksumManifest looks for a checksums file attached to a release
+// under each of the --checksums-candidates names and returns the first one
+// found, with its url. {repo}, {tag} and {version}, the tag without its
+// "v" as GoReleaser names the file, are replaced in the names. The manifest
+// is nil when the release has none of them.
+func discoverChecksumManifest(pr project, tag string, a hashAlgo) (checksumManifest, string, error) {
+	r := strings.NewReplacer("{repo}", pr.repo, "{tag}", tag, "{version}", strings.TrimPrefix(tagVersion(tag), "v"))
+	for _, c := range checksumsCandidates {
+		url := pr.releaseURL(tag, r.Replace(c))
+		if exists, err := urlExists(url); err != nil {
+			return nil, "", err
+		} else if !exists {
+			continue
+		}
+		m, err := fetchChecksumManifest(url, a)
+		if errors.Is(err, errAssetNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return m, url, nil
+	}
+	return nil, "", nil
+}
+
+// fetchChecksumManifest downloads and parses a checksums file.
+func fetchChecksumManifest(url string, a hashAlgo) (checksumManifest, error) {
+	name, err := downloadAsset(url, defaultDownloadOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download checksums file: %w", err)
+	}
+	if downloadDir == "" {
+		defer os.Remove(name)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checksums file: %w", err)
+	}
+	defer f.Close()
+
+	m := checksumManifest{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// "<checksum>  <name>", or "<checksum> *<name>" for binary mode.
+		sum, file, ok := strings.Cut(line, " ")
+		file = strings.TrimPrefix(strings.TrimSpace(file), "*")
+		if !ok || file == "" {
+			return nil, fmt.Errorf("checksums file %s: line %d: expected \"<checksum>  <file>\"", redactURL(url), n)
+		}
+		sum = strings.ToLower(sum)
+		if len(sum) != a.hexLen() {
+			return nil, fmt.Errorf("checksums file %s: line %d: checksum is not a %s checksum", redactURL(url), n, a.name)
+		}
+		m[file] = sum
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checksums file: %w", err)
+	}
+	return m, nil
+}
+
+// lookup returns the checksum listed for binaryName. Names in the manifest
+// may carry a directory prefix (e.g. dist/myapp-linux-amd64): the
+// --checksums-strip-prefix is removed first, and failing an exact match the
+// last path component is compared, with either / or \ as separator.
+func (m checksumManifest) lookup(binaryName string) (string, bool) {
+	var found string
+	matches := 0
+	for file, sum := range m {
+		name := strings.TrimPrefix(file, checksumsStripPrefix)
+		if name == binaryName {
+			return sum, true
+		}
+		if baseName(name) == binaryName {
+			found = sum
+			matches++
+		}
+	}
+	// Several directories holding the same file name is ambiguous.
+	return found, matches == 1
+}
+
+func baseName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// minChunkSize is the smallest range --parallel-chunks splits a download
+// into; smaller assets are downloaded in one stream.
+const minChunkSize = 1 << 20
+
+// errRangesUnsupported is returned when a server doesn't answer a range
+// request with the part asked for, so the asset can't be split.
+var errRangesUnsupported = errors.New("server does not support range requests")
+
+// fetchChunks downloads url into f as --parallel-chunks ranges fetched at
+// once, each written at its offset so f ends up in order. Each range is
+// retried on its own. Any error means f must be downloaded again in one
+// stream.
+func fetchChunks(f *os.File, url string, opts downloadOptions) error {
+	size, err := probeSize(url, opts)
+	if err != nil {
+		return err
+	}
+	n := min(int64(parallelChunks), size/minChunkSize)
+	if n < 2 {
+		return fmt.Errorf("%d bytes is too small to split", size)
+	}
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("failed to size download file: %w", err)
+	}
+
+	chunk := (size + n - 1) / n
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := int64(0); i < n; i++ {
+		start, end := i*chunk, min((i+1)*chunk, size)-1
+		wg.Add(1)
+		go func(i, start, end int64) {
+			defer wg.Done()
+			for attempt := 0; attempt <= opts.retries; attempt++ {
+				if attempt > 0 {
+					time.Sleep(time.Duration(attempt) * time.Second)
+				}
+				if errs[i] = fetchChunk(f, url, start, end, opts); errs[i] == nil || !isRetryable(errs[i]) {
+					return
+				}
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	recordExists(url, true)
+	if verbose {
+		fmt.Fprintf(opts.log, "Downloaded %s in %d chunks\n", redactURL(url), n)
+	}
+	return nil
+}
+
+// probeSize asks for the first byte of url and returns the size of the
+// asset from the Content-Range of the answer.
+func probeSize(url string, opts downloadOptions) (int64, error) {
+	resp, err := rangeRequest(url, 0, 0, opts)
+	if err != nil {
+		return 0, err
+	}
+	// Close without reading: a server ignoring the range sends the whole
+	// asset.
+	defer resp.Body.Close()
+
+	_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	size, err := strconv.ParseInt(total, 10, 64)
+	if resp.StatusCode != http.StatusPartialContent || rangeStart(resp) != 0 || err != nil {
+		return 0, errRangesUnsupported
+	}
+	return size, nil
+}
+
+// fetchChunk downloads bytes start to end of url into the same bytes of f.
+func fetchChunk(f *os.File, url string, start, end int64, opts downloadOptions) error {
+	resp, err := rangeRequest(url, start, end, opts)
+	if err != nil {
+		return &retryableError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || rangeStart(resp) != start {
+		return fmt.Errorf("failed to download bytes %d-%d of %s: status %s: %w", start, end, redactURL(url), resp.Status, errRangesUnsupported)
+	}
+
+	n, err := io.Copy(io.NewOffsetWriter(f, start), io.LimitReader(limitBody(resp.Body), end-start+1))
+	bytesDownloaded.Add(n)
+	if opts.received != nil {
+		atomic.AddInt64(opts.received, n)
+	}
+	if err == nil && n != end-start+1 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return &retryableError{fmt.Errorf("failed to download bytes %d-%d of %s: %w", start, end, redactURL(url), err)}
+	}
+	return nil
+}
+
+// rangeRequest sends a GET for bytes start to end of url. The timeout of
+// opts applies to the whole response, body included.
+func rangeRequest(url string, start, end int64, opts downloadOptions) (*http.Response, error) {
+	ctx := context.WithValue(context.Background(), logKey{}, opts.log)
+	var cancel context.CancelFunc = func() {}
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create request for %s: %w", redactURL(url), err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := opts.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to download %s: %w", redactURL(url), redactError(err))
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose cancels a request's context once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// clobberedURLs returns the lines of original, numbered, that have a url
+// not belonging to pr and that updated changes or removes. brewup only
+// rewrites pr's release and archive urls, so any such line means a
+// replacement matched more than it should have.
+func clobberedURLs(original, updated string, pr project) []string {
+	prefix := strings.ToLower(fmt.Sprintf("https://github.com/%s/%s/", pr.org, pr.repo))
+	var clobbered []string
+	n := 0
+	for _, op := range diffLines(splitLines(original), splitLines(updated)) {
+		if op.kind != '+' {
+			n++
+		}
+		if op.kind != '-' {
+			continue
+		}
+		for _, m := range formulaURLRegex.FindAllStringSubmatch(op.line, -1) {
+			if !strings.HasPrefix(strings.ToLower(m[1]), prefix) {
+				clobbered = append(clobbered, fmt.Sprintf("%d: %s", n, strings.TrimSpace(op.line)))
+				break
+			}
+		}
+	}
+	return clobbered
+}
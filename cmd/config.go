@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read from the working directory when --config is
+// not given.
+const defaultConfigFile = ".brewup.yaml"
+
+// config is the content of a brewup config file. Flags given on the
+// command line take precedence over the config file.
+type config struct {
+	Retries *int      `yaml:"retries" desc:"Number of times to retry a failed download"`
+	Timeout *duration `yaml:"timeout" desc:"Timeout for each download attempt"`
+
+	// PlatformOverrides tunes downloads of individual platforms, keyed by
+	// os/arch (e.g. darwin/arm64).
+	PlatformOverrides map[string]downloadOverride `yaml:"platform_overrides" key:"<os/arch>" desc:"Download settings for one platform, replacing retries and timeout"`
+
+	// VersionMap maps release versions to the version written in the
+	// formula, merged with --version-map.
+	VersionMap map[string]string `yaml:"version_map" key:"<version>" desc:"Formula version to write for a release version, e.g. v1.2.3: 1.2.3_1"`
+
+	// Algorithms lists the checksum lines every url block has, for formulas
+	// pinning several digests of each binary.
+	Algorithms []string `yaml:"algorithms" desc:"Checksum algorithms every url block has a line for, the --algo one first; all are computed in one download"`
+
+	// PlatformPresets adds --platforms-preset values, or replaces built-in
+	// ones of the same name.
+	PlatformPresets map[string]platformPreset `yaml:"platform_presets" key:"<name>" desc:"A platform matrix to select with --platforms-preset"`
+}
+
+// downloadOverride replaces the global download settings for one platform.
+type downloadOverride struct {
+	Retries *int      `yaml:"retries" desc:"Number of times to retry a failed download of this platform"`
+	Timeout *duration `yaml:"timeout" desc:"Timeout for each download attempt of this platform"`
+}
+
+// duration is a time.Duration written as a string such as "90s" or "5m".
+type duration time.Duration
+
+func (d *duration) UnmarshalYAML(n *yaml.Node) error {
+	v, err := time.ParseDuration(n.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", n.Line, n.Value)
+	}
+	*d = duration(v)
+	return nil
+}
+
+var cfg config
+
+// fromConfig records the flags whose value came from the config file.
+var fromConfig = map[string]bool{}
+
+// loadConfig reads the config file and applies it to the flags that were
+// not set on the command line.
+func loadConfig(flags *pflag.FlagSet) error {
+	path := configFileUsed()
+	if path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if cfg.Retries != nil && !flags.Changed("retries") {
+		retries = *cfg.Retries
+		fromConfig["retries"] = true
+	}
+	if cfg.Timeout != nil && !flags.Changed("timeout") {
+		timeout = time.Duration(*cfg.Timeout)
+		fromConfig["timeout"] = true
+	}
+
+	if err := validateVersionMap(cfg.VersionMap); err != nil {
+		return fmt.Errorf("config file %s: version_map: %w", path, err)
+	}
+	for tag, v := range cfg.VersionMap {
+		if _, ok := versionMap[tag]; !ok {
+			if versionMap == nil {
+				versionMap = map[string]string{}
+			}
+			versionMap[tag] = v
+			fromConfig["version-map"] = true
+		}
+	}
+
+	for key, o := range cfg.PlatformOverrides {
+		if _, err := splitPlatform(key); err != nil {
+			return fmt.Errorf("config file %s: platform_overrides: %w", path, err)
+		}
+		if o.Retries != nil && *o.Retries < 0 {
+			return fmt.Errorf("config file %s: platform_overrides: %s: retries must not be negative", path, key)
+		}
+	}
+	for name, pre := range cfg.PlatformPresets {
+		if len(pre.Platforms) == 0 {
+			return fmt.Errorf("config file %s: platform_presets: %s: no platforms", path, name)
+		}
+		for _, token := range pre.Platforms {
+			if _, err := splitPlatform(token); err != nil {
+				return fmt.Errorf("config file %s: platform_presets: %s: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkPlatformOverrides fails when a platform_overrides key names a
+// platform outside the matrix, once the matrix is known.
+func checkPlatformOverrides() error {
+	for key := range cfg.PlatformOverrides {
+		if _, err := parsePlatform(key); err != nil {
+			return fmt.Errorf("config file %s: platform_overrides: %w", configFileUsed(), err)
+		}
+	}
+	return nil
+}
+
+// configFileUsed returns the config file brewup reads: --config, or
+// defaultConfigFile if it exists. It is empty when there is none.
+func configFileUsed() string {
+	if configFile != "" {
+		return configFile
+	}
+	if _, err := os.Stat(defaultConfigFile); errors.Is(err, os.ErrNotExist) {
+		return ""
+	}
+	return defaultConfigFile
+}
+
+// effectiveConfig is the output of --show-config.
+type effectiveConfig struct {
+	ConfigFile        string                       `json:"config_file,omitempty"`
+	Settings          []effectiveSetting           `json:"settings"`
+	PlatformOverrides map[string]effectiveOverride `json:"platform_overrides,omitempty"`
+	Environment       map[string]string            `json:"environment,omitempty"`
+}
+
+// effectiveSetting is the value brewup uses for one flag and where it came
+// from: "flag", "config" or "default".
+type effectiveSetting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+type effectiveOverride struct {
+	Retries *int   `json:"retries,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// secretEnv lists the environment variables brewup reads that hold
+// credentials; --show-config only reports whether they are set.
+var secretEnv = []string{"GITHUB_TOKEN"}
+
+// resolvedConfig returns the settings brewup runs with, after the config
+// file has been applied to flags.
+func resolvedConfig(flags *pflag.FlagSet) effectiveConfig {
+	ec := effectiveConfig{ConfigFile: configFileUsed()}
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Name == "show-config" || f.Name == "help" {
+			return
+		}
+		source := "default"
+		switch {
+		case flags.Changed(f.Name):
+			source = "flag"
+		case fromConfig[f.Name]:
+			source = "config"
+		}
+		ec.Settings = append(ec.Settings, effectiveSetting{Name: f.Name, Value: f.Value.String(), Source: source})
+	})
+
+	for key, o := range cfg.PlatformOverrides {
+		if ec.PlatformOverrides == nil {
+			ec.PlatformOverrides = map[string]effectiveOverride{}
+		}
+		eo := effectiveOverride{Retries: o.Retries}
+		if o.Timeout != nil {
+			eo.Timeout = time.Duration(*o.Timeout).String()
+		}
+		ec.PlatformOverrides[key] = eo
+	}
+
+	for _, name := range secretEnv {
+		if os.Getenv(name) != "" {
+			if ec.Environment == nil {
+				ec.Environment = map[string]string{}
+			}
+			ec.Environment[name] = "<redacted>"
+		}
+	}
+	return ec
+}
+
+// showConfig prints the effective configuration as JSON for --format json
+// and as text otherwise.
+func showConfig(w io.Writer, ec effectiveConfig) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(ec)
+	}
+
+	if ec.ConfigFile != "" {
+		fmt.Fprintf(w, "Config file: %s\n", ec.ConfigFile)
+	} else {
+		fmt.Fprintln(w, "Config file: none")
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range ec.Settings {
+		fmt.Fprintf(tw, "%s\t%s\t(%s)\n", s.Name, s.Value, s.Source)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	var keys []string
+	for key := range ec.PlatformOverrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		o := ec.PlatformOverrides[key]
+		fmt.Fprintf(w, "platform_overrides %s:", key)
+		if o.Retries != nil {
+			fmt.Fprintf(w, " retries=%d", *o.Retries)
+		}
+		if o.Timeout != "" {
+			fmt.Fprintf(w, " timeout=%s", o.Timeout)
+		}
+		fmt.Fprintln(w)
+	}
+	for _, name := range secretEnv {
+		if v, ok := ec.Environment[name]; ok {
+			fmt.Fprintf(w, "%s=%s\n", name, v)
+		}
+	}
+	return nil
+}
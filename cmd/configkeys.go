@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var configKeysFormat string
+
+var configKeysCmd = &cobra.Command{
+	Use:   "config-keys",
+	Short: "List every flag and config file key brewup understands",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys := configKeyList{
+			Flags:  flagKeys(rootCmd.LocalFlags()),
+			Config: configFileKeys(reflect.TypeOf(config{}), ""),
+		}
+		switch configKeysFormat {
+		case "text":
+			return printConfigKeys(os.Stdout, keys)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(keys)
+		default:
+			return fmt.Errorf("unsupported --format %q (supported: text, json)", configKeysFormat)
+		}
+	},
+}
+
+func init() {
+	configKeysCmd.Flags().StringVar(&configKeysFormat, "format", "text", "Output format (text, json)")
+	rootCmd.AddCommand(configKeysCmd)
+}
+
+// configKeyList is the output of brewup config-keys.
+type configKeyList struct {
+	Flags  []configKey `json:"flags"`
+	Config []configKey `json:"config"`
+}
+
+// configKey describes one flag or config file key.
+type configKey struct {
+	Name        string `json:"name"`
+	Shorthand   string `json:"shorthand,omitempty"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description"`
+}
+
+// flagKeys lists the flags registered on flags, in the order pflag sorts
+// them. Hidden flags are left out, as they are of --help.
+func flagKeys(flags *pflag.FlagSet) []configKey {
+	var keys []configKey
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		keys = append(keys, configKey{
+			Name:        "--" + f.Name,
+			Shorthand:   f.Shorthand,
+			Type:        f.Value.Type(),
+			Default:     f.DefValue,
+			Description: f.Usage,
+		})
+	})
+	return keys
+}
+
+var durationType = reflect.TypeOf(duration(0))
+
+// configFileKeys lists the keys of the config file struct t, named by
+// their yaml tag and documented by their desc tag. Map fields are listed
+// with their key tag as a placeholder (e.g. platform_overrides.<os/arch>),
+// followed by the keys of their values when those are structs. Keys named
+// like a flag default to that flag's default.
+func configFileKeys(t reflect.Type, prefix string) []configKey {
+	var keys []configKey
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := prefix + f.Tag.Get("yaml")
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Map && ft.Elem().Kind() == reflect.Struct {
+			name += "." + f.Tag.Get("key")
+			keys = append(keys, configKey{Name: name, Type: "map", Description: f.Tag.Get("desc")})
+			keys = append(keys, configFileKeys(ft.Elem(), name+".")...)
+			continue
+		}
+		if ft.Kind() == reflect.Map {
+			name += "." + f.Tag.Get("key")
+			ft = ft.Elem()
+		}
+
+		k := configKey{Name: name, Type: configKeyType(ft), Description: f.Tag.Get("desc")}
+		if prefix == "" {
+			if fl := rootCmd.Flags().Lookup(strings.ReplaceAll(name, "_", "-")); fl != nil {
+				k.Default = fl.DefValue
+			}
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func configKeyType(t reflect.Type) string {
+	if t == durationType {
+		return "duration"
+	}
+	return t.Kind().String()
+}
+
+func printConfigKeys(w io.Writer, keys configKeyList) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FLAG\tTYPE\tDEFAULT\tDESCRIPTION")
+	for _, k := range keys.Flags {
+		name := k.Name
+		if k.Shorthand != "" {
+			name += ", -" + k.Shorthand
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, k.Type, k.Default, k.Description)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "CONFIG KEY (%s)\tTYPE\tDEFAULT\tDESCRIPTION\n", defaultConfigFile)
+	for _, k := range keys.Config {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", k.Name, k.Type, k.Default, k.Description)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import "testing"
+
+func TestFlagKeysSkipsHidden(t *testing.T) {
+	keys := flagKeys(rootCmd.LocalFlags())
+	if len(keys) == 0 {
+		t.Fatal("no flags listed")
+	}
+	for _, k := range keys {
+		if k.Name == "--selftest" {
+			t.Errorf("hidden flag %s listed", k.Name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestDeterministicOutput updates the same formula several times with
+// parallel downloads and checks that the log and the written formula are
+// byte for byte the same every time.
+func TestDeterministicOutput(t *testing.T) {
+	serveAssets(t, releaseAssets("v1.0.5"))
+	original, err := os.ReadFile("../examples/sbomasm.rb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := copyExample(t, "sbomasm.rb")
+
+	var firstLog string
+	var firstFormula []byte
+	for i := 0; i < 5; i++ {
+		resetURLCache()
+		if err := os.WriteFile(path, original, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		log, err := runBrewup(t, "-f", path, "-v", "v1.0.5", "--deterministic-output", "--verbose", "--concurrency", "4", "--canonicalize", "--report-bandwidth")
+		if err != nil {
+			t.Fatal(err)
+		}
+		formula, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if !strings.Contains(log, "Downloaded (linux-amd64)") {
+				t.Fatalf("no per-platform output to compare:\n%s", log)
+			}
+			firstLog, firstFormula = log, formula
+			continue
+		}
+		if log != firstLog {
+			t.Fatalf("run %d logged\n%s\nrun 1 logged\n%s", i+1, log, firstLog)
+		}
+		if !bytes.Equal(formula, firstFormula) {
+			t.Fatalf("run %d wrote\n%s\nrun 1 wrote\n%s", i+1, formula, firstFormula)
+		}
+	}
+}
+
+func TestCanonicalizeDeterministic(t *testing.T) {
+	b, err := os.ReadFile("../examples/sbomasm.rb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := project{org: "interlynk-io", repo: "sbomasm"}
+	first := canonicalize(string(b), pr)
+	for i := 0; i < 5; i++ {
+		if got := canonicalize(string(b), pr); got != first {
+			t.Fatalf("canonicalize gave\n%s\nthen\n%s", first, got)
+		}
+	}
+	if again := canonicalize(first, pr); again != first {
+		t.Errorf("canonicalize is not idempotent:\n%s\nthen\n%s", first, again)
+	}
+}
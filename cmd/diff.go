@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// patch collects the changes of a --patch-out run, one file after another.
+var patch strings.Builder
+
+// patchPath returns the path of a formula as written in the patch:
+// relative to the working directory when possible, which is where git apply
+// and patch -p1 are run from.
+func patchPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// writePatch writes the changes collected in the run to --patch-out.
+func writePatch() error {
+	if err := os.WriteFile(patchOut, []byte(patch.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write patch: %w", err)
+	}
+	return nil
+}
+
+// diffOp is one line of an edit script: kept (' '), removed ('-') or added
+// ('+'). Lines carry their newline, so a missing newline at the end of a
+// file counts as a change.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLines splits s into lines, each keeping its "\n".
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script turning a into b, from their
+// longest common subsequence. Formulas are small enough for the quadratic
+// table.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// unifiedDiff returns a unified diff from oldContent to newContent with
+// context lines around each change, in the format git apply and patch
+// accept. It is empty when the contents are equal.
+func unifiedDiff(path, oldContent, newContent string, context int) string {
+	if oldContent == newContent {
+		return ""
+	}
+	ops := diffLines(splitLines(oldContent), splitLines(newContent))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+	oldLine, newLine := 1, 1 // line numbers at ops[pos]
+	pos := 0
+	for pos < len(ops) {
+		// Find the next change, and extend the hunk over every change
+		// separated from the previous one by at most twice the context.
+		first := pos
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for k := first + 1; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				if k-last-1 > 2*context {
+					break
+				}
+				last = k
+			}
+		}
+		start, end := max(pos, first-context), min(len(ops), last+context+1)
+
+		// Only kept lines lie between hunks.
+		oldLine += start - pos
+		newLine += start - pos
+		oldLen, newLen := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldLen++
+			}
+			if op.kind != '-' {
+				newLen++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldLine, oldLen), hunkRange(newLine, newLen))
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		oldLine += oldLen
+		newLine += newLen
+		pos = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk. An empty
+// side starts at the line before it.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
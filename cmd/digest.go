@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// releaseDigest returns one digest over every checksum a formula pins, so a
+// change to any asset changes it. It is the sha256 of one
+// "<platform>  <checksum>\n" line per platform, sorted, e.g.
+//
+//	darwin-amd64  240cec...
+//	darwin-arm64  df7981...
+//
+// which can be reproduced with sha256sum from the formula alone. Platforms
+// left unchanged count with the checksum the formula keeps; pruned ones
+// are left out.
+func releaseDigest(platforms []platformSummary) string {
+	var lines []string
+	for _, p := range platforms {
+		sum := p.NewChecksum
+		if p.Status == "skipped" {
+			sum = p.OldChecksum
+		}
+		if sum == "" || p.Status == "pruned" {
+			continue
+		}
+		lines = append(lines, p.Platform+"  "+sum+"\n")
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(strings.Join(lines, ""))))
+}
+
+var digestCommentRegex = regexp.MustCompile(`(?m)^[ \t]*# release digest: sha256:[0-9a-f]{64}[ \t]*\n`)
+
+var (
+	digestVersionRegex = regexp.MustCompile(`(?m)^([ \t]*)version "[^\n]*\n`)
+	digestURLRegex     = regexp.MustCompile(`(?m)^([ \t]*)url "`)
+)
+
+// setDigestComment records digest in a "# release digest: ..." comment
+// after the formula's version line, or before its first url without one,
+// replacing any comment written before.
+func setDigestComment(content, digest string) string {
+	content = digestCommentRegex.ReplaceAllString(content, "")
+	if digest == "" {
+		return content
+	}
+	if loc := digestVersionRegex.FindStringSubmatchIndex(content); loc != nil {
+		return content[:loc[1]] + content[loc[2]:loc[3]] + "# release digest: " + digest + "\n" + content[loc[1]:]
+	}
+	if loc := digestURLRegex.FindStringSubmatchIndex(content); loc != nil {
+		return content[:loc[0]] + content[loc[2]:loc[3]] + "# release digest: " + digest + "\n" + content[loc[0]:]
+	}
+	return content
+}
+
+// hasDigestComment reports whether a formula records a release digest.
+func hasDigestComment(content string) bool {
+	return digestCommentRegex.MatchString(content)
+}
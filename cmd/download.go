@@ -0,0 +1,414 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxAutoConcurrency caps --concurrency auto, so a large platform matrix
+// doesn't open enough parallel downloads to get throttled by the host.
+const maxAutoConcurrency = 8
+
+// autoConcurrency picks how many downloads to run at once for n assets:
+// one per asset, but no more than twice the CPU count (downloads mostly wait
+// on the network, hashing is what uses the CPU) and maxAutoConcurrency.
+func autoConcurrency(n int) int {
+	return max(1, min(n, 2*runtime.NumCPU(), maxAutoConcurrency))
+}
+
+// parseConcurrency parses --concurrency: "auto" or a positive number.
+func parseConcurrency(s string, assets int) (int, error) {
+	if s == "auto" {
+		return autoConcurrency(assets), nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid --concurrency %q, expected auto or a positive number", s)
+	}
+	return n, nil
+}
+
+// httpClient makes every request brewup sends. Replace its transport with
+// SetTransport.
+var httpClient = &http.Client{CheckRedirect: checkRedirect}
+
+// SetTransport makes brewup send its requests through rt, e.g. to replay
+// recorded responses in tests or to sign requests. It must be called
+// before Execute.
+func SetTransport(rt http.RoundTripper) {
+	httpClient.Transport = rt
+}
+
+// redirectError reports a redirect loop or more redirects than
+// --max-redirects, with the chain of urls followed.
+type redirectError struct {
+	reason string
+	chain  []string
+}
+
+func (e *redirectError) Error() string {
+	return fmt.Sprintf("%s: %s", e.reason, strings.Join(e.chain, " -> "))
+}
+
+// checkRedirect is the CheckRedirect of httpClient. It stops at a url
+// already visited, which would loop forever, and after --max-redirects
+// hops.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	chain := make([]string, 0, len(via)+1)
+	for _, r := range via {
+		chain = append(chain, redactURL(r.URL.String()))
+	}
+	chain = append(chain, redactURL(req.URL.String()))
+
+	for _, r := range via {
+		if r.URL.String() == req.URL.String() {
+			return &redirectError{reason: "redirect loop", chain: chain}
+		}
+	}
+	if len(via) > maxRedirects {
+		return &redirectError{reason: fmt.Sprintf("more than %d redirects", maxRedirects), chain: chain}
+	}
+	if verbose {
+		log := logOut
+		if w, ok := req.Context().Value(logKey{}).(io.Writer); ok {
+			log = w
+		}
+		fmt.Fprintf(log, "Redirected to %s\n", redactURL(req.URL.String()))
+	}
+	return nil
+}
+
+// downloadOptions controls how one asset is downloaded.
+type downloadOptions struct {
+	client  *http.Client
+	retries int
+	timeout time.Duration // per attempt; zero means no timeout
+	log     io.Writer     // receives --verbose progress
+
+	// received, when set, is increased by the bytes received.
+	received *int64
+}
+
+// defaultDownloadOptions returns the download settings from --retries and
+// --timeout.
+func defaultDownloadOptions() downloadOptions {
+	return downloadOptions{client: httpClient, retries: retries, timeout: timeout, log: logOut}
+}
+
+// logKey is the context key of the writer checkRedirect logs redirects to.
+type logKey struct{}
+
+// downloadOptionsFor returns the download settings for p: --retries and
+// --timeout, replaced by p's platform_overrides entry in the config file.
+func downloadOptionsFor(p platform) downloadOptions {
+	opts := defaultDownloadOptions()
+	if o, ok := cfg.PlatformOverrides[p.key()]; ok {
+		if o.Retries != nil {
+			opts.retries = *o.Retries
+		}
+		if o.Timeout != nil {
+			opts.timeout = time.Duration(*o.Timeout)
+		}
+	}
+	return opts
+}
+
+// downloadAsset fetches url into a local file and returns the path to it.
+// When a download fails part way, the next attempt asks the server for the
+// remaining bytes with a Range request instead of starting from zero. Servers
+// that ignore ranges are handled by truncating and downloading again.
+func downloadAsset(url string, opts downloadOptions) (string, error) {
+	f, err := openDownloadFile(url)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Split the download into ranges when asked to and the server allows,
+	// and otherwise download in one stream.
+	if exists, known := cachedExists(url); parallelChunks > 1 && (exists || !known) {
+		err := fetchChunks(f, url, opts)
+		if err == nil {
+			return f.Name(), nil
+		}
+		if verbose {
+			fmt.Fprintf(opts.log, "Downloading %s in one stream: %v\n", redactURL(url), err)
+		}
+		if err := restart(f); err != nil {
+			return "", err
+		}
+	}
+
+	var lastErr error
+	refreshed := false
+	for attempt := 0; attempt <= opts.retries; attempt++ {
+		if attempt > 0 {
+			if verbose {
+				fmt.Fprintf(opts.log, "Retrying %s (%d/%d): %v\n", redactURL(url), attempt, opts.retries, lastErr)
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if lastErr = fetchInto(f, url, opts); lastErr == nil {
+			if verbose {
+				fmt.Fprintf(opts.log, "Downloaded %s after %d retries\n", redactURL(url), attempt)
+			}
+			return f.Name(), nil
+		}
+
+		// Get a new pre-signed url once, without using up a retry.
+		if errors.Is(lastErr, errSignatureExpired) && urlRefreshCommand != "" && !refreshed {
+			refreshed = true
+			newURL, err := refreshURL(urlRefreshCommand, url)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			fmt.Fprintf(opts.log, "Signature of %s expired, retrying with a refreshed URL\n", redactURL(url))
+			url = newURL
+			attempt--
+			continue
+		}
+		if !isRetryable(lastErr) {
+			break
+		}
+	}
+
+	if downloadDir == "" {
+		os.Remove(f.Name())
+	}
+	return "", lastErr
+}
+
+// openDownloadFile creates the file an asset is downloaded into. Assets go
+// to --download-dir when set, and to a temporary file otherwise.
+func openDownloadFile(url string) (*os.File, error) {
+	if downloadDir == "" {
+		f, err := os.CreateTemp("", "brewup-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		return f, nil
+	}
+
+	if err := os.MkdirAll(downloadDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(downloadDir, path.Base(strings.SplitN(url, "?", 2)[0])), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download file: %w", err)
+	}
+	return f, nil
+}
+
+// fetchInto downloads url into f, resuming from the current size of f.
+func fetchInto(f *os.File, url string, opts downloadOptions) error {
+	// Errors name the url without its signature, if it is pre-signed.
+	shown := redactURL(url)
+
+	if exists, known := cachedExists(url); known && !exists {
+		return fmt.Errorf("failed to download %s: %w", shown, errAssetNotFound)
+	}
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek download file: %w", err)
+	}
+
+	ctx := context.WithValue(context.Background(), logKey{}, opts.log)
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", shown, err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := opts.client.Do(req)
+	var redirectErr *redirectError
+	if errors.As(err, &redirectErr) {
+		// Following the same redirects again won't help.
+		return fmt.Errorf("failed to download %s: %w", shown, redirectErr)
+	}
+	if err != nil {
+		return &retryableError{fmt.Errorf("failed to download %s: %w", shown, redactError(err))}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && rangeStart(resp) == offset:
+		// Resume: append the remaining bytes.
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range (or this is the first attempt).
+		if err := restart(f); err != nil {
+			return err
+		}
+	case resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// Unexpected range response; start over without one next time.
+		if err := restart(f); err != nil {
+			return err
+		}
+		return &retryableError{fmt.Errorf("failed to resume %s: status %s", shown, resp.Status)}
+	case resp.StatusCode == http.StatusForbidden:
+		return forbiddenError(url, resp)
+	case resp.StatusCode == http.StatusNotFound:
+		recordExists(url, false)
+		return fmt.Errorf("failed to download %s: %w", shown, errAssetNotFound)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return &retryableError{fmt.Errorf("failed to download %s: status %s", shown, resp.Status)}
+	default:
+		return fmt.Errorf("failed to download %s: status %s", shown, resp.Status)
+	}
+
+	recordExists(url, true)
+	n, err := io.Copy(f, limitBody(resp.Body))
+	bytesDownloaded.Add(n)
+	if opts.received != nil {
+		atomic.AddInt64(opts.received, n)
+	}
+	if err != nil {
+		return &retryableError{fmt.Errorf("failed to download %s: %w", shown, err)}
+	}
+	return nil
+}
+
+// restart truncates f so the next write starts from the beginning.
+func restart(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate download file: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek download file: %w", err)
+	}
+	return nil
+}
+
+// rangeStart returns the first byte position of a Content-Range header, or
+// -1 if the header is missing or malformed.
+func rangeStart(resp *http.Response) int64 {
+	cr := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	start, _, ok := strings.Cut(cr, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// errAssetNotFound is returned when the server answers 404; how it is
+// handled is up to --on-404.
+var errAssetNotFound = errors.New("asset not found (404)")
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+func isRetryable(err error) bool {
+	_, ok := err.(*retryableError)
+	return ok
+}
+
+func calculateChecksum(url string, a hashAlgo, opts downloadOptions) (string, error) {
+	sums, err := calculateChecksums(url, []hashAlgo{a}, opts)
+	if err != nil {
+		return "", err
+	}
+	return sums[0], nil
+}
+
+// hashInMemory makes calculateChecksums hash each download in memory
+// instead of through a file. --selftest sets it.
+var hashInMemory bool
+
+// calculateChecksums downloads url once and returns its checksum with each
+// of algos, in order, hashing the file in a single pass.
+func calculateChecksums(url string, algos []hashAlgo, opts downloadOptions) ([]string, error) {
+	if hashInMemory {
+		return fetchChecksums(url, algos, opts)
+	}
+	name, err := downloadAsset(url, opts)
+	if err != nil {
+		return nil, err
+	}
+	if downloadDir == "" {
+		defer os.Remove(name)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open downloaded file: %w", err)
+	}
+	defer f.Close()
+	return hashAll(f, algos)
+}
+
+// fetchChecksums downloads url into memory in one attempt and hashes it.
+func fetchChecksums(url string, algos []hashAlgo, opts downloadOptions) ([]string, error) {
+	shown := redactURL(url)
+	resp, err := opts.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", shown, redactError(err))
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		recordExists(url, false)
+		return nil, fmt.Errorf("failed to download %s: %w", shown, errAssetNotFound)
+	default:
+		return nil, fmt.Errorf("failed to download %s: status %s", shown, resp.Status)
+	}
+	recordExists(url, true)
+	b, err := io.ReadAll(limitBody(resp.Body))
+	bytesDownloaded.Add(int64(len(b)))
+	if opts.received != nil {
+		atomic.AddInt64(opts.received, int64(len(b)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", shown, err)
+	}
+	return hashAll(bytes.NewReader(b), algos)
+}
+
+// hashAll reads r to the end and returns its checksum with each of algos.
+func hashAll(r io.Reader, algos []hashAlgo) ([]string, error) {
+	hashers := make([]hash.Hash, len(algos))
+	writers := make([]io.Writer, len(algos))
+	for i, a := range algos {
+		hashers[i] = a.new()
+		writers[i] = hashers[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return nil, fmt.Errorf("failed to compute checksum: %w", err)
+	}
+
+	sums := make([]string, len(algos))
+	for i, h := range hashers {
+		sums[i] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return sums, nil
+}
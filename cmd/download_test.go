@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCalculateChecksumsEmptyBody(t *testing.T) {
+	resetURLCache()
+	srv := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	a := hashAlgos["sha256"]
+	sums, err := calculateChecksums(srv.URL+"/sbomasm-linux-amd64", []hashAlgo{a}, defaultDownloadOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.isEmptyInput(sums[0]) {
+		t.Errorf("checksum of an empty body = %s, want the sha256 of empty input", sums[0])
+	}
+}
+
+func TestUpdateFormulaEmptyBody(t *testing.T) {
+	// Every binary but linux-amd64 downloads fine.
+	assets := releaseAssets("v1.0.5")
+	assets["/interlynk-io/sbomasm/releases/download/v1.0.5/sbomasm-linux-amd64"] = ""
+	serveAssets(t, assets)
+
+	path := copyExample(t, "sbomasm.rb")
+	_, err := runBrewup(t, "-f", path, "-v", "v1.0.5")
+	if err == nil || !strings.Contains(err.Error(), "checksum for linux-amd64 is the sha256 of empty input") {
+		t.Fatalf("err = %v, want the empty input error for linux-amd64", err)
+	}
+}
+
+func TestConcurrencyOneDownloadsInOrder(t *testing.T) {
+	assets := releaseAssets("v1.0.5")
+	var mu sync.Mutex
+	var got []string
+	serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, path.Base(r.URL.Path))
+		mu.Unlock()
+		io.WriteString(w, assets[r.URL.Path])
+	}))
+
+	var want []string
+	for _, p := range defaultPlatforms {
+		want = append(want, p.binaryName("sbomasm"))
+	}
+	// Goroutines started at once would race for the one slot.
+	for run := 0; run < 20; run++ {
+		got = nil
+		file := copyExample(t, "sbomasm.rb")
+		if _, err := runBrewup(t, "-f", file, "-v", "v1.0.5", "--concurrency", "1", "--dry-run"); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d downloaded %v, want %v", run+1, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestLatin1RoundTrip updates the non-UTF-8 fixture and checks that only
+// the version, url and checksum lines changed, and that every other byte,
+// including the invalid UTF-8 ones, is written back as it was.
+func TestLatin1RoundTrip(t *testing.T) {
+	serveAssets(t, releaseAssets("v1.0.5"))
+	path := copyExample(t, "sbomasm-latin1.rb")
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utf8.Valid(original) {
+		t.Fatal("fixture is valid UTF-8, it must not be")
+	}
+
+	if _, err := runBrewup(t, "-f", path, "-v", "v1.0.5"); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	managed := regexp.MustCompile(`^\s*(version|url|sha256) "`)
+	lines := bytes.Split(updated, []byte("\n"))
+	changed := changedLines(t, original, updated)
+	// The version line and a url and sha256 line per platform.
+	if want := 1 + 2*len(defaultPlatforms); len(changed) != want {
+		t.Errorf("%d lines changed, want %d: %v", len(changed), want, changed)
+	}
+	for _, n := range changed {
+		if !managed.Match(lines[n-1]) {
+			t.Errorf("line %d changed, though brewup doesn't manage it: %q", n, lines[n-1])
+		}
+	}
+	for _, b := range []string{"\xe9", "\xfc", "\xff\xfe", "\xc3("} {
+		if bytes.Count(updated, []byte(b)) != bytes.Count(original, []byte(b)) {
+			t.Errorf("bytes %q were not written back as they were", b)
+		}
+	}
+	if !strings.Contains(string(updated), `version "v1.0.5"`) {
+		t.Error("version was not updated")
+	}
+}
+
+func TestFormulaEncodingUTF8RejectsLatin1(t *testing.T) {
+	serveAssets(t, releaseAssets("v1.0.5"))
+	path := copyExample(t, "sbomasm-latin1.rb")
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runBrewup(t, "-f", path, "-v", "v1.0.5", "--formula-encoding", "utf-8")
+	if err == nil || !strings.Contains(err.Error(), "formula file is not valid UTF-8 at line 19") {
+		t.Fatalf("err = %v, want the invalid UTF-8 error for line 19", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, original) {
+		t.Error("the rejected formula was modified")
+	}
+}
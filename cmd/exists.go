@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// urlCache remembers, for the current run, which urls exist, so checking
+// the same url again (e.g. a checksums file shared by several formulas, or
+// an asset probed before it is downloaded) doesn't send another request.
+var urlCache = struct {
+	sync.Mutex
+	exists map[string]bool
+}{exists: map[string]bool{}}
+
+// resetURLCache forgets every url, so nothing is carried over between
+// runs.
+func resetURLCache() {
+	urlCache.Lock()
+	defer urlCache.Unlock()
+	urlCache.exists = map[string]bool{}
+}
+
+// cachedExists returns what is known about url in this run.
+func cachedExists(url string) (exists, known bool) {
+	urlCache.Lock()
+	defer urlCache.Unlock()
+	exists, known = urlCache.exists[url]
+	return exists, known
+}
+
+func recordExists(url string, exists bool) {
+	urlCache.Lock()
+	defer urlCache.Unlock()
+	urlCache.exists[url] = exists
+}
+
+// urlExists reports whether url can be downloaded, with a HEAD request the
+// first time it is asked in a run.
+func urlExists(url string) (bool, error) {
+	if exists, known := cachedExists(url); known {
+		return exists, nil
+	}
+
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request for %s: %w", redactURL(url), err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s: %w", redactURL(url), redactError(err))
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		recordExists(url, false)
+		return false, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		recordExists(url, true)
+		return true, nil
+	default:
+		return false, fmt.Errorf("failed to check %s: status %s", redactURL(url), resp.Status)
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// checkAssetRepo implements --expected-org-repo-in-asset: it fails unless
+// the path of assetURL has pr's org and repo as consecutive segments, so a
+// glob, template or override that resolved to another project's release is
+// caught before its binary is downloaded and hashed. GitHub names are
+// compared ignoring case, as GitHub does.
+func checkAssetRepo(assetURL string, pr project) error {
+	if !expectOrgRepo {
+		return nil
+	}
+	u, err := url.Parse(assetURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse asset url %s: %w", redactURL(assetURL), err)
+	}
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i := 1; i < len(segments); i++ {
+		if strings.EqualFold(segments[i-1], pr.org) && strings.EqualFold(segments[i], pr.repo) {
+			return nil
+		}
+	}
+	return fmt.Errorf("asset url %s does not contain %s in its path (--expected-org-repo-in-asset); check --asset-glob, --org and --repo", redactURL(assetURL), pr)
+}
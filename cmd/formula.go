@@ -0,0 +1,473 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// platform is an os/arch pair that a formula has a url block for.
+type platform struct {
+	os   string
+	arch string
+}
+
+// defaultPlatforms is the platform matrix unless --platforms or
+// --platforms-preset selects another.
+var defaultPlatforms = []platform{
+	{"darwin", "arm64"},
+	{"darwin", "amd64"},
+	{"linux", "arm64"},
+	{"linux", "amd64"},
+}
+
+// platforms is the platform matrix of the current run.
+var platforms = defaultPlatforms
+
+// platformOrder returns the platforms in the order they are processed and
+// reported: the platform matrix, or sorted by os then arch with
+// --deterministic-output.
+func platformOrder() []platform {
+	if !deterministicOutput {
+		return platforms
+	}
+	sorted := append([]platform(nil), platforms...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].os != sorted[j].os {
+			return sorted[i].os < sorted[j].os
+		}
+		return sorted[i].arch < sorted[j].arch
+	})
+	return sorted
+}
+
+func (p platform) String() string {
+	return p.os + "-" + p.arch
+}
+
+// parsePlatform parses an os/arch token such as darwin/arm64 naming a
+// platform of the matrix.
+func parsePlatform(s string) (platform, error) {
+	p, err := splitPlatform(s)
+	if err != nil {
+		return platform{}, err
+	}
+	for _, known := range platforms {
+		if known == p {
+			return p, nil
+		}
+	}
+	return platform{}, fmt.Errorf("unknown platform %q", s)
+}
+
+// splitPlatform parses an os/arch token without checking it against the
+// matrix.
+func splitPlatform(s string) (platform, error) {
+	osName, arch, ok := strings.Cut(s, "/")
+	if !ok || osName == "" || arch == "" {
+		return platform{}, fmt.Errorf("invalid platform %q, expected os/arch (e.g. darwin/arm64)", s)
+	}
+	return platform{osName, arch}, nil
+}
+
+// key returns the os/arch token used to refer to p in flags and config.
+func (p platform) key() string {
+	return p.os + "/" + p.arch
+}
+
+func (p platform) binaryName(repo string) string {
+	return fmt.Sprintf("%s-%s-%s", repo, p.os, p.arch)
+}
+
+// project identifies the GitHub repository a formula's binaries are
+// released from.
+type project struct {
+	org  string
+	repo string
+}
+
+func (pr project) String() string {
+	return pr.org + "/" + pr.repo
+}
+
+func (pr project) releaseURL(version, binaryName string) string {
+	return fmt.Sprintf("https://github.com/%s/%s/releases/download/%s/%s", pr.org, pr.repo, version, binaryName)
+}
+
+// nounzipPattern matches the ", :using => :nounzip" of a url line, which
+// bare binaries carry and archives such as GoReleaser's go without.
+const nounzipPattern = `(?:,\s*:using\s*=>\s*:nounzip)?`
+
+// assetRegex matches the url line of a platform block and the checksum line
+// that follows it, capturing the url and the checksum.
+func assetRegex(pr project, p platform, a hashAlgo) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`url "(https://github\.com/%s/%s/releases/download/%s/%s)"%s\n\s*%s "([0-9a-f]{%d})"`, regexp.QuoteMeta(pr.org), regexp.QuoteMeta(pr.repo), tagPattern(), regexp.QuoteMeta(p.binaryName(pr.repo)), nounzipPattern, a.name, a.hexLen()))
+}
+
+// checksumBeforeRegex matches a checksum line written directly before the
+// url line of urlPattern, the reverse of the usual order, capturing the
+// keyword, the checksum, its comment, the url line and the url.
+func checksumBeforeRegex(urlPattern string, a hashAlgo) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(%s )"([0-9a-f]*)"(%s)?(\n[ \t]*url "(%s)"%s)`, a.name, checksumCommentPattern, urlPattern, nounzipPattern))
+}
+
+// currentAsset returns the url and checksum a formula currently pins for p.
+func currentAsset(content string, pr project, p platform, a hashAlgo) (url, checksum string, ok bool) {
+	urlPattern := fmt.Sprintf(`https://github\.com/%s/%s/releases/download/%s/%s`, regexp.QuoteMeta(pr.org), regexp.QuoteMeta(pr.repo), tagPattern(), regexp.QuoteMeta(p.binaryName(pr.repo)))
+	if m := checksumBeforeRegex(urlPattern, a).FindStringSubmatch(content); m != nil && len(m[2]) == a.hexLen() && checksumFirst(content, m[5], a) {
+		return m[5], m[2], true
+	}
+	m := assetRegex(pr, p, a).FindStringSubmatch(content)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// checksumAt returns the checksum of a formula's url "<url>" line: on the
+// line following it, or on the line before it in formulas written that
+// way.
+func checksumAt(content, url string, a hashAlgo) string {
+	if checksumFirst(content, url, a) {
+		if m := checksumBeforeRegex(regexp.QuoteMeta(url), a).FindStringSubmatch(content); m != nil && len(m[2]) == a.hexLen() {
+			return m[2]
+		}
+		return ""
+	}
+	re := regexp.MustCompile(fmt.Sprintf(`url "%s"%s\n\s*%s "([0-9a-f]{%d})"`, regexp.QuoteMeta(url), nounzipPattern, a.name, a.hexLen()))
+	if m := re.FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// checksumFirst reports whether the checksum of url is written before its
+// url line rather than after it. Inside an "if Hardware::CPU..." block the
+// order of the block's own lines decides. Elsewhere, a checksum line right
+// after the url line wins over one right before it.
+func checksumFirst(content, url string, a hashAlgo) bool {
+	lines := strings.Split(content, "\n")
+	urlLine := fmt.Sprintf(`url "%s"`, url)
+	isChecksum := func(l string) bool { return strings.HasPrefix(strings.TrimSpace(l), a.name+` "`) }
+	for i, l := range lines {
+		if !strings.Contains(l, urlLine) {
+			continue
+		}
+		// The nearest block opened above the url line that is still open.
+		for j := i - 1; j >= 0; j-- {
+			m := platformBlockRegex.FindStringSubmatch(lines[j])
+			if m == nil {
+				continue
+			}
+			end := blockEnd(lines, j, m[1])
+			if end < i {
+				break
+			}
+			for k := j + 1; k < end; k++ {
+				if isChecksum(lines[k]) {
+					return k < i
+				}
+			}
+			return false
+		}
+		return !(i+1 < len(lines) && isChecksum(lines[i+1])) && i > 0 && isChecksum(lines[i-1])
+	}
+	return false
+}
+
+// blockChecksumRegex matches the x checksum line of the url block of url:
+// the url line, any other checksum lines, then x's line, capturing
+// everything up to the checksum and the checksum.
+func blockChecksumRegex(url string, x hashAlgo) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(url "%s"%s\n(?:[ \t]*(?:%s) "[0-9a-f]*"[^\n]*\n)*?[ \t]*%s )"([0-9a-f]*)"`, regexp.QuoteMeta(url), nounzipPattern, strings.Join(hashNames(), "|"), x.name))
+}
+
+// blockChecksum returns the x checksum of the url block of url.
+func blockChecksum(content, url string, x hashAlgo) (string, bool) {
+	if m := blockChecksumRegex(url, x).FindStringSubmatch(content); m != nil {
+		return m[2], true
+	}
+	return "", false
+}
+
+// releaseTag returns the git tag of a version: the version with --tag-prefix
+// in front, e.g. subproject/v1.2.3 for monorepos tagging per subproject.
+func releaseTag(version string) string {
+	return tagPrefix + version
+}
+
+// tagVersion returns the version of a git tag, the tag without --tag-prefix.
+func tagVersion(tag string) string {
+	return strings.TrimPrefix(tag, tagPrefix)
+}
+
+// tagPattern matches a release tag in a download url.
+func tagPattern() string {
+	return regexp.QuoteMeta(tagPrefix) + `v\d+\.\d+\.\d+`
+}
+
+var formulaURLRegex = regexp.MustCompile(`url "([^"]+)"`)
+
+// versionRegex matches a formula's version line: a tag, or a version
+// mapped from one with --version-map such as 1.2.3_1. Only a line of its
+// own counts, not a version inside a dependency or an assertion.
+var versionRegex = regexp.MustCompile(`(?m)^([ \t]*)version\s+"(v?\d[0-9A-Za-z._+-]*)"`)
+
+// replaceVersionLine returns content with the value of its first version
+// line replaced by newVersion(old), where old is the current value.
+func replaceVersionLine(content string, newVersion func(old string) string) string {
+	m := versionRegex.FindStringSubmatchIndex(content)
+	if m == nil {
+		return content
+	}
+	line := fmt.Sprintf(`%sversion "%s"`, content[m[2]:m[3]], newVersion(content[m[4]:m[5]]))
+	return content[:m[0]] + line + content[m[1]:]
+}
+
+// formulaVersion returns the tag in a formula's version line, if any.
+// Versions written from --version-map are mapped back to their tag, the
+// lowest one if several tags map to the version.
+func formulaVersion(content string) string {
+	m := versionRegex.FindStringSubmatch(content)
+	if m == nil {
+		return ""
+	}
+	return unmappedVersion(m[2])
+}
+
+// unmappedVersion returns the tag a version line value was written for:
+// the lowest tag --version-map maps to v, or v itself.
+func unmappedVersion(v string) string {
+	var tags []string
+	for tag, mapped := range versionMap {
+		if mapped == v {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		sort.Strings(tags)
+		return tags[0]
+	}
+	return v
+}
+
+// mappedVersion returns the version to write in the version line for a
+// tag: its --version-map entry, or the tag itself.
+func mappedVersion(tag string) string {
+	if v, ok := versionMap[tag]; ok {
+		return v
+	}
+	return tag
+}
+
+var (
+	versionMapKeyRegex   = regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
+	versionMapValueRegex = regexp.MustCompile(`^\d[0-9A-Za-z._+-]*$`)
+)
+
+// validateVersionMap checks that --version-map maps release versions such
+// as v1.2.3 to Homebrew versions such as 1.2.3_1.
+func validateVersionMap(m map[string]string) error {
+	for tag, v := range m {
+		if !versionMapKeyRegex.MatchString(tag) {
+			return fmt.Errorf("invalid version map entry %s=%s: %q is not a version such as v1.2.3", tag, v, tag)
+		}
+		if !versionMapValueRegex.MatchString(strings.TrimPrefix(v, "v")) {
+			return fmt.Errorf("invalid version map entry %s=%s: %q is not a valid formula version", tag, v, v)
+		}
+	}
+	return nil
+}
+
+var projectURLRegex = regexp.MustCompile(`https://github\.com/([^/"]+)/([^/"]+)/(?:releases/download|archive)/`)
+
+// referencedProjects returns the GitHub repositories whose release
+// downloads or source archives a formula references, sorted.
+func referencedProjects(content string) []project {
+	seen := map[project]bool{}
+	var projects []project
+	for _, m := range projectURLRegex.FindAllStringSubmatch(content, -1) {
+		pr := project{org: m[1], repo: m[2]}
+		if !seen[pr] {
+			seen[pr] = true
+			projects = append(projects, pr)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].String() < projects[j].String() })
+	return projects
+}
+
+// inferProject returns the GitHub repository a formula downloads its
+// binaries from. In a tap, where the formula is Formula/<name>.rb, the name
+// picks the repository when the URLs reference several, and is the
+// repository when they reference none.
+func inferProject(path, content string) (project, error) {
+	projects := referencedProjects(content)
+	name := tapFormulaName(path)
+	switch {
+	case len(projects) == 1:
+		return projects[0], nil
+	case len(projects) == 0 && name != "":
+		return project{repo: name}, nil
+	case len(projects) == 0:
+		return project{}, fmt.Errorf("no release URLs found, pass --repo")
+	}
+
+	var named []project
+	for _, pr := range projects {
+		if pr.repo == name {
+			named = append(named, pr)
+		}
+	}
+	switch {
+	case len(named) == 1:
+		return named[0], nil
+	case len(named) > 1:
+		return project{}, fmt.Errorf("release URLs reference several repositories named after the formula %s %v, pass --repo and --org", name, named)
+	case name != "":
+		return project{}, fmt.Errorf("release URLs reference several repositories %v, none named after the formula %s; pass --repo", projects, name)
+	default:
+		return project{}, fmt.Errorf("release URLs reference several repositories %v, pass --repo", projects)
+	}
+}
+
+// tapFormulaName returns the name of a formula in a tap's Formula or
+// HomebrewFormula directory, or "" for a formula elsewhere.
+func tapFormulaName(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	switch filepath.Base(filepath.Dir(abs)) {
+	case "Formula", "HomebrewFormula":
+		return strings.TrimSuffix(filepath.Base(abs), ".rb")
+	}
+	return ""
+}
+
+// formulaClass returns the Ruby class Homebrew expects for a formula name,
+// e.g. sbom-asm becomes SbomAsm and foo@2 becomes FooAT2.
+func formulaClass(name string) string {
+	name = strings.ReplaceAll(name, "@", "AT")
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '-' || r == '_' || r == '.' {
+			upper = true
+			continue
+		}
+		if upper {
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var classRegex = regexp.MustCompile(`(?m)^class\s+(\w+)\s*<\s*Formula\b`)
+
+// declaredClass returns the class a formula file declares, if any.
+func declaredClass(content string) string {
+	if m := classRegex.FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+var (
+	testBlockRegex    = regexp.MustCompile(`^(\s*)test do\s*$`)
+	caveatsBlockRegex = regexp.MustCompile(`^(\s*)def caveats\s*$`)
+)
+
+// updateBlockVersion replaces oldTag with newTag, with or without their
+// "v", inside the first block opened by a line matching block only, such
+// as the formula's test block.
+func updateBlockVersion(content string, block *regexp.Regexp, oldTag, newTag string) string {
+	if oldTag == "" || oldTag == newTag {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for i, l := range lines {
+		m := block.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		end := blockEnd(lines, i, m[1])
+		if end < 0 {
+			break
+		}
+		for j := i + 1; j < end; j++ {
+			lines[j] = replaceVersion(lines[j], oldTag, newTag)
+		}
+		break
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replaceVersion replaces oldTag with newTag in s, with or without their
+// "v". Versions are matched only as a whole: 1.0.1 doesn't match inside
+// 1.0.10, 1.0.1.2, v1.0.1a or x1.0.1, but does before a "," or at the end
+// of a sentence.
+func replaceVersion(s, oldTag, newTag string) string {
+	bare, newBare := strings.TrimPrefix(oldTag, "v"), strings.TrimPrefix(newTag, "v")
+	re := regexp.MustCompile(`v?` + regexp.QuoteMeta(bare))
+
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringIndex(s, -1) {
+		start, end := m[0], m[1]
+		if !versionBoundary(s, start, end) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		if s[start] == 'v' {
+			b.WriteString("v")
+		}
+		b.WriteString(newBare)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// versionBoundary reports whether s[start:end] is a whole version: not
+// preceded by a letter, digit or ".", and not followed by a letter, digit
+// or a "." starting another component.
+func versionBoundary(s string, start, end int) bool {
+	isWord := func(c byte) bool {
+		return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	if start > 0 && (isWord(s[start-1]) || s[start-1] == '.') {
+		return false
+	}
+	if end < len(s) {
+		if isWord(s[end]) {
+			return false
+		}
+		if s[end] == '.' && end+1 < len(s) && s[end+1] >= '0' && s[end+1] <= '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// updateDependsVersion replaces oldTag with newTag in the version
+// constraint of depends_on "name" => "...", and reports whether there was
+// such a constraint pinned to oldTag. Other dependencies are left alone.
+func updateDependsVersion(content, name, oldTag, newTag string) (string, bool) {
+	re := regexp.MustCompile(`(depends_on\s+"` + regexp.QuoteMeta(name) + `"\s*=>\s*")([^"]*)"`)
+	found := false
+	content = re.ReplaceAllStringFunc(content, func(s string) string {
+		m := re.FindStringSubmatch(s)
+		constraint := replaceVersion(m[2], oldTag, newTag)
+		if constraint != m[2] {
+			found = true
+		}
+		return m[1] + constraint + `"`
+	})
+	return content, found
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReplaceVersion(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`assert_match "v1.0.3", out`, `assert_match "v1.0.4", out`},
+		{`assert_match "1.0.3", out`, `assert_match "1.0.4", out`},
+		{"sbomasm v1.0.3 is installed.", "sbomasm v1.0.4 is installed."},
+		{"1.0.3,1.0.3", "1.0.4,1.0.4"},
+		{"v1.0.3 v1.0.3", "v1.0.4 v1.0.4"},
+		{"1.0.3", "1.0.4"},
+		// Other versions that contain the old one are left alone.
+		{"v1.0.30", "v1.0.30"},
+		{"1.0.30", "1.0.30"},
+		{"1.0.3.1", "1.0.3.1"},
+		{"v1.0.3.1", "v1.0.3.1"},
+		{"11.0.3", "11.0.3"},
+		{"2.1.0.3", "2.1.0.3"},
+		{"v1.0.3a", "v1.0.3a"},
+		{"xv1.0.3", "xv1.0.3"},
+		{"v1.0.30 and v1.0.3", "v1.0.30 and v1.0.4"},
+	}
+	for _, tt := range tests {
+		if got := replaceVersion(tt.in, "v1.0.3", "v1.0.4"); got != tt.want {
+			t.Errorf("replaceVersion(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateDependsVersion(t *testing.T) {
+	content := `  depends_on "sbomasm-plugins" => "v1.0.40"
+  depends_on "sbomasm-lib" => ">= 1.0.4, < 1.0.4.1"
+  depends_on "jq"
+`
+	got, found := updateDependsVersion(content, "sbomasm-plugins", "v1.0.4", "v1.0.5")
+	if found || got != content {
+		t.Errorf("v1.0.40 was taken for v1.0.4:\n%s", got)
+	}
+
+	want := `  depends_on "sbomasm-plugins" => "v1.0.40"
+  depends_on "sbomasm-lib" => ">= 1.0.5, < 1.0.4.1"
+  depends_on "jq"
+`
+	got, found = updateDependsVersion(content, "sbomasm-lib", "v1.0.4", "v1.0.5")
+	if !found || got != want {
+		t.Errorf("updateDependsVersion = %v\n%s\nwant\n%s", found, got, want)
+	}
+}
+
+func TestUpdateBlockVersion(t *testing.T) {
+	content := `  def caveats
+    "Run sbomasm 1.0.4 or later; 1.0.40 is not supported, nor 1.0.4.1."
+  end
+
+  test do
+    assert_match "v1.0.4,v1.0.4", shell_output("#{bin}/sbomasm version")
+  end
+`
+	want := `  def caveats
+    "Run sbomasm 1.0.5 or later; 1.0.40 is not supported, nor 1.0.4.1."
+  end
+
+  test do
+    assert_match "v1.0.5,v1.0.5", shell_output("#{bin}/sbomasm version")
+  end
+`
+	got := updateBlockVersion(content, caveatsBlockRegex, "v1.0.4", "v1.0.5")
+	got = updateBlockVersion(got, testBlockRegex, "v1.0.4", "v1.0.5")
+	if got != want {
+		t.Errorf("updateBlockVersion =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestVersionLineOnly(t *testing.T) {
+	const (
+		dep  = `  depends_on "foo" => { min_version "2.0" }`
+		test = `    assert_match version "v1.0.4", shell_output("#{bin}/sbomasm version")`
+	)
+	insert := func(content string) string {
+		content = strings.Replace(content, `  license "Apache-2.0"`, `  license "Apache-2.0"`+"\n"+dep, 1)
+		return strings.Replace(content, "\nend\n", "\n\n  test do\n"+test+"\n  end\nend\n", 1)
+	}
+
+	serveAssets(t, releaseAssets("v1.0.5"))
+	path := copyExample(t, "sbomasm.rb")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(insert(string(b))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runBrewup(t, "-f", path, "-v", "v1.0.5"); err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`  version "v1.0.5"`, dep, test} {
+		if !strings.Contains(string(b), want+"\n") {
+			t.Errorf("formula has no line %q:\n%s", want, b)
+		}
+	}
+
+	// Source formulas too; only the first version line is replaced.
+	content := "class Sbomasm < Formula\n  url \"https://github.com/interlynk-io/sbomasm/archive/refs/tags/v1.0.4.tar.gz\"\n  version \"1.0.4\"\n" + dep + "\n  version \"1.0.4\"\nend\n"
+	got := replaceVersionLine(content, func(old string) string { return sourceVersionFor(old, "v1.0.5") })
+	want := strings.Replace(content, `version "1.0.4"`, `version "1.0.5"`, 1)
+	if got != want {
+		t.Errorf("replaceVersionLine =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// adjacentChecksum returns the sha256 on the line right before or right
+// after the url line of url.
+func adjacentChecksum(t *testing.T, content, url string, before bool) string {
+	t.Helper()
+	lines := strings.Split(content, "\n")
+	for i, l := range lines {
+		if !strings.Contains(l, `url "`+url+`"`) {
+			continue
+		}
+		j := i + 1
+		if before {
+			j = i - 1
+		}
+		sum, ok := strings.CutPrefix(strings.TrimSpace(lines[j]), `sha256 "`)
+		if !ok {
+			t.Fatalf("line %d next to the url of %s is not a sha256 line: %q", j+1, url, lines[j])
+		}
+		return strings.TrimSuffix(sum, `"`)
+	}
+	t.Fatalf("formula has no url %s:\n%s", url, content)
+	return ""
+}
+
+func TestChecksumFirst(t *testing.T) {
+	pr := project{org: "interlynk-io", repo: "sbomasm"}
+	assets := releaseAssets("v1.0.5")
+	serveAssets(t, assets)
+	path := copyExample(t, "sbomasm-sha256-first.rb")
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mixed: the linux blocks are written url first, the macOS ones not.
+	mixed := string(orig)
+	for _, arch := range []string{"arm64", "amd64"} {
+		url := pr.releaseURL("v1.0.4", "sbomasm-linux-"+arch)
+		sum := adjacentChecksum(t, mixed, url, true)
+		shaLine := `      sha256 "` + sum + `"`
+		urlLine := `      url "` + url + `", :using => :nounzip`
+		mixed = strings.Replace(mixed, shaLine+"\n"+urlLine, urlLine+"\n"+shaLine, 1)
+	}
+	mixedPath := copyExample(t, "sbomasm-sha256-first.rb")
+	if err := os.WriteFile(mixedPath, []byte(mixed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name, path  string
+		linuxBefore bool
+	}{
+		{"sha256 first", path, true},
+		{"mixed", mixedPath, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := runBrewup(t, "-f", tt.path, "-v", "v1.0.5"); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range defaultPlatforms {
+				url := pr.releaseURL("v1.0.5", p.binaryName(pr.repo))
+				before := p.os == "darwin" || tt.linuxBefore
+				want := fmt.Sprintf("%x", sha256.Sum256([]byte(assets[strings.TrimPrefix(url, "https://github.com")])))
+				if got := adjacentChecksum(t, string(b), url, before); got != want {
+					t.Errorf("%s: checksum %s, want %s", p, got, want)
+				}
+			}
+			if _, err := runBrewup(t, "-f", tt.path, "--check"); err != nil {
+				t.Errorf("check after update: %v", err)
+			}
+		})
+	}
+}
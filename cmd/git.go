@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// changedFormulas returns the .rb files that differ in the given git range.
+// A single revision compares the working tree against it, so "HEAD" covers
+// uncommitted changes; "origin/main..HEAD" covers the commits about to be
+// pushed. Deleted files are omitted.
+func changedFormulas(rangeSpec string) ([]string, error) {
+	out, err := exec.Command("git", "diff", "--name-only", "--relative", "--diff-filter=d", rangeSpec, "--", "*.rb").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("git diff %s failed: %s", rangeSpec, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to run git diff: %w", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if _, err := os.Stat(line); err == nil {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// githubRelease is the subset of the GitHub release API response brewup uses.
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Name       string `json:"name"`
+	HTMLURL    string `json:"html_url"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+
+	Assets []githubAsset `json:"assets"`
+}
+
+// githubAsset is a file attached to a release.
+type githubAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// githubGet fetches a GitHub API url and decodes the JSON response into v.
+// GITHUB_TOKEN is sent when set to raise the API rate limit.
+func githubGet(url string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", redactURL(url), err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return redactError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// latestRelease asks the GitHub API for a project's latest release.
+func latestRelease(pr project) (githubRelease, error) {
+	var rel githubRelease
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", pr.org, pr.repo)
+	if err := githubGet(url, &rel); err != nil {
+		return githubRelease{}, fmt.Errorf("failed to fetch latest release of %s: %w", pr, err)
+	}
+	if rel.TagName == "" {
+		return githubRelease{}, fmt.Errorf("latest release of %s has no tag", pr)
+	}
+	return rel, nil
+}
+
+// releaseByTag asks the GitHub API for the release of a tag.
+func releaseByTag(pr project, tag string) (githubRelease, error) {
+	var rel githubRelease
+	escaped := url.PathEscape(tag) // tags may contain slashes with --tag-prefix
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/tags/%s", pr.org, pr.repo, escaped)
+	if err := githubGet(url, &rel); err != nil {
+		return githubRelease{}, fmt.Errorf("failed to fetch release %s of %s: %w", tag, pr, err)
+	}
+	return rel, nil
+}
+
+// listReleases returns every published release of a project, newest first.
+func listReleases(pr project) ([]githubRelease, error) {
+	var all []githubRelease
+	for page := 1; ; page++ {
+		var rels []githubRelease
+		url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases?per_page=100&page=%d", pr.org, pr.repo, page)
+		if err := githubGet(url, &rels); err != nil {
+			return nil, fmt.Errorf("failed to list releases of %s: %w", pr, err)
+		}
+		for _, r := range rels {
+			if !r.Draft {
+				all = append(all, r)
+			}
+		}
+		if len(rels) < 100 {
+			return all, nil
+		}
+	}
+}
+
+// resolveVersionRange returns the highest release of a project whose tag
+// satisfies r; a nil r allows every version. Pre-releases, tags that aren't
+// semantic versions and, with --tag-prefix, tags without the prefix are
+// ignored.
+func resolveVersionRange(pr project, r versionRange) (githubRelease, error) {
+	rels, err := listReleases(pr)
+	if err != nil {
+		return githubRelease{}, err
+	}
+
+	var best githubRelease
+	var bestVer semver
+	for _, rel := range rels {
+		if rel.Prerelease {
+			continue
+		}
+		if !strings.HasPrefix(rel.TagName, tagPrefix) {
+			continue
+		}
+		v, err := parseSemver(tagVersion(rel.TagName))
+		if err != nil || !r.allows(v) {
+			continue
+		}
+		if best.TagName == "" || v.compare(bestVer) > 0 {
+			best, bestVer = rel, v
+		}
+	}
+	if best.TagName == "" && r == nil {
+		return githubRelease{}, fmt.Errorf("no release of %s has a tag starting with %q", pr, tagPrefix)
+	}
+	if best.TagName == "" {
+		return githubRelease{}, fmt.Errorf("no release of %s matches version range %q", pr, versionRangeStr)
+	}
+	return best, nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// archAliases are the names GoReleaser's generated config gives some
+// architectures in archive names, after uname -m.
+var archAliases = map[string]string{"amd64": "x86_64", "386": "i386"}
+
+// expandAssetGlob fills the placeholders of --asset-glob for one platform:
+// {repo}, {os}, {arch} and {version}, and {Os} and {arch_alias} for the
+// title-cased os and uname style arch, e.g. Darwin and x86_64.
+func expandAssetGlob(pr project, p platform, tag string) string {
+	alias, ok := archAliases[p.arch]
+	if !ok {
+		alias = p.arch
+	}
+	title := strings.ToUpper(p.os[:1]) + p.os[1:]
+	return strings.NewReplacer("{repo}", pr.repo, "{os}", p.os, "{arch}", p.arch, "{version}", tag, "{Os}", title, "{arch_alias}", alias).Replace(assetGlob)
+}
+
+// matchGlob reports whether name matches pattern, a path.Match pattern in
+// which {a,b} matches either a or b. Alternatives may nest.
+func matchGlob(pattern, name string) (bool, error) {
+	for _, alt := range expandBraces(pattern) {
+		ok, err := path.Match(alt, name)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// expandBraces returns the patterns of the first {a,b} group of pattern
+// and, recursively, of the groups after it. Braces without a comma are
+// kept as they are.
+func expandBraces(pattern string) []string {
+	start := strings.IndexByte(pattern, '{')
+	if start < 0 {
+		return []string{pattern}
+	}
+	depth, end := 0, -1
+	var commas []int
+	for i := start; i < len(pattern) && end < 0; i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				end = i
+			}
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		}
+	}
+	if end < 0 || len(commas) == 0 {
+		var out []string
+		for _, rest := range expandBraces(pattern[start+1:]) {
+			out = append(out, pattern[:start+1]+rest)
+		}
+		return out
+	}
+
+	var out []string
+	bounds := append(append([]int{start}, commas...), end)
+	for i := 1; i < len(bounds); i++ {
+		alt := pattern[:start] + pattern[bounds[i-1]+1:bounds[i]] + pattern[end+1:]
+		out = append(out, expandBraces(alt)...)
+	}
+	return out
+}
+
+// matchAsset returns the release asset matching --asset-glob for p. More
+// than one match is an error with --strict, and otherwise the first match
+// in the release's listing is used, noting so on log.
+func matchAsset(rel githubRelease, pr project, p platform, log io.Writer) (githubAsset, error) {
+	pattern := expandAssetGlob(pr, p, tagVersion(rel.TagName))
+
+	var matches []githubAsset
+	for _, asset := range rel.Assets {
+		ok, err := matchGlob(pattern, asset.Name)
+		if err != nil {
+			return githubAsset{}, fmt.Errorf("invalid --asset-glob %q: %w", pattern, err)
+		}
+		if ok {
+			matches = append(matches, asset)
+		}
+	}
+
+	switch {
+	case len(matches) == 0:
+		return githubAsset{}, fmt.Errorf("no asset of release %s matches %q: %w", rel.TagName, pattern, errAssetNotFound)
+	case len(matches) > 1 && strict:
+		var names []string
+		for _, m := range matches {
+			names = append(names, m.Name)
+		}
+		return githubAsset{}, fmt.Errorf("several assets of release %s match %q: %s (pass --strict=false to use the first)", rel.TagName, pattern, strings.Join(names, ", "))
+	case len(matches) > 1:
+		fmt.Fprintf(log, "Several assets match %q, using %s\n", pattern, matches[0].Name)
+	}
+	return matches[0], nil
+}
+
+// formulaAssetURL returns the url a formula currently has for p when assets
+// are matched with --asset-glob: the release download url whose file name
+// matches the glob expanded for the formula's current version.
+func formulaAssetURL(content string, pr project, p platform) (string, error) {
+	pattern := expandAssetGlob(pr, p, formulaVersion(content))
+	prefix := fmt.Sprintf("https://github.com/%s/%s/releases/download/", pr.org, pr.repo)
+
+	var found []string
+	for _, m := range formulaURLRegex.FindAllStringSubmatch(content, -1) {
+		if !strings.HasPrefix(m[1], prefix) {
+			continue
+		}
+		if ok, _ := matchGlob(pattern, path.Base(m[1])); ok {
+			found = append(found, m[1])
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no url in the formula matches %q for %s", pattern, p)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("several urls in the formula match %q for %s", pattern, p)
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"sbomasm", []string{"sbomasm"}},
+		{"a{b,c}d", []string{"abd", "acd"}},
+		{"a{,.tar.gz}", []string{"a", "a.tar.gz"}},
+		{"{a,b}{c,d}", []string{"ac", "ad", "bc", "bd"}},
+		{"x{a,{b,c}_y}", []string{"xa", "xb_y", "xc_y"}},
+		{"{nocomma}{a,b}", []string{"{nocomma}a", "{nocomma}b"}},
+		{"open{a,b", []string{"open{a,b"}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGoreleaserDefaultGlob(t *testing.T) {
+	defer func(g string) { assetGlob = g }(assetGlob)
+	assetGlob = platformPresets["goreleaser-default"].AssetGlob
+	pr := project{org: "interlynk-io", repo: "sbomasm"}
+
+	tests := []struct {
+		p     platform
+		name  string
+		match bool
+	}{
+		{platform{"darwin", "amd64"}, "sbomasm_1.0.5_darwin_amd64.tar.gz", true},
+		{platform{"linux", "arm64"}, "sbomasm_1.0.5_linux_arm64.zip", true},
+		{platform{"linux", "arm64"}, "sbomasm_1.0.5_linux_arm64", true},
+		{platform{"darwin", "amd64"}, "sbomasm_Darwin_x86_64.tar.gz", true},
+		{platform{"linux", "arm64"}, "sbomasm_Linux_arm64.tar.gz", true},
+		{platform{"darwin", "amd64"}, "sbomasm_1.0.5_darwin_arm64.tar.gz", false},
+		{platform{"darwin", "arm64"}, "sbomasm_Darwin_x86_64.tar.gz", false},
+		{platform{"linux", "amd64"}, "sbomasm_1.0.5_linux_amd64.tar.gz.sbom.json", false},
+		{platform{"linux", "amd64"}, "checksums.txt", false},
+	}
+	for _, tt := range tests {
+		got, err := matchGlob(expandAssetGlob(pr, tt.p, "v1.0.5"), tt.name)
+		if err != nil || got != tt.match {
+			t.Errorf("%s: match %s = %v, %v, want %v", tt.p, tt.name, got, err, tt.match)
+		}
+	}
+}
+
+func TestGoreleaserDefaultPreset(t *testing.T) {
+	const base = "/interlynk-io/sbomasm/releases/download/v1.0.5/"
+	names := map[string]string{
+		"darwin-arm64": "sbomasm_Darwin_arm64.tar.gz",
+		"darwin-amd64": "sbomasm_Darwin_x86_64.tar.gz",
+		"linux-arm64":  "sbomasm_Linux_arm64.tar.gz",
+		"linux-amd64":  "sbomasm_Linux_x86_64.tar.gz",
+	}
+	var rel githubRelease
+	rel.TagName = "v1.0.5"
+	for _, name := range names {
+		rel.Assets = append(rel.Assets, githubAsset{Name: name, BrowserDownloadURL: "https://github.com" + base + name})
+	}
+	rel.Assets = append(rel.Assets, githubAsset{Name: "checksums.txt", BrowserDownloadURL: "https://github.com" + base + "checksums.txt"})
+	serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/interlynk-io/sbomasm/releases/tags/v1.0.5":
+			json.NewEncoder(w).Encode(rel)
+		case strings.HasPrefix(r.URL.Path, base):
+			w.Write([]byte(strings.TrimPrefix(r.URL.Path, base)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	// As GoReleaser writes it: archives, so no :using => :nounzip.
+	oldSum := func(name string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte("v1.0.4 "+name))) }
+	var formula strings.Builder
+	formula.WriteString("class Sbomasm < Formula\n  version \"v1.0.4\"\n")
+	for _, block := range []struct{ os, cpu, key string }{
+		{"on_macos", "intel?", "darwin-amd64"}, {"on_macos", "arm?", "darwin-arm64"},
+		{"on_linux", "intel?", "linux-amd64"}, {"on_linux", "arm?", "linux-arm64"},
+	} {
+		fmt.Fprintf(&formula, "\n  %s do\n    if Hardware::CPU.%s\n", block.os, block.cpu)
+		fmt.Fprintf(&formula, "      url \"https://github.com/interlynk-io/sbomasm/releases/download/v1.0.4/%s\"\n", names[block.key])
+		fmt.Fprintf(&formula, "      sha256 \"%s\"\n\n      def install\n        bin.install \"sbomasm\"\n      end\n    end\n  end\n", oldSum(names[block.key]))
+	}
+	formula.WriteString("end\n")
+	path := filepath.Join(t.TempDir(), "sbomasm.rb")
+	if err := os.WriteFile(path, []byte(formula.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runBrewup(t, "-f", path, "-v", "v1.0.5", "--platforms-preset", "goreleaser-default"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, name := range names {
+		url := "https://github.com" + base + name
+		if want := `url "` + url + "\"\n      sha256 \"" + fmt.Sprintf("%x", sha256.Sum256([]byte(name))) + `"`; !strings.Contains(string(b), want) {
+			t.Errorf("%s was not updated to %s:\n%s", key, url, b)
+		}
+		if strings.Contains(string(b), oldSum(name)) {
+			t.Errorf("%s still has its old checksum:\n%s", key, b)
+		}
+	}
+	if strings.Contains(string(b), ":using") {
+		t.Errorf("archive urls were given :using => :nounzip:\n%s", b)
+	}
+
+	log, err := runBrewup(t, "-f", path, "--check", "--platforms-preset", "goreleaser-default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := range names {
+		if !strings.Contains(log, "Checksum ("+key+"): OK") {
+			t.Errorf("--check did not verify %s:\n%s", key, log)
+		}
+	}
+}
+
+func TestPresetsReadsConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "brewup.yaml")
+	if err := os.WriteFile(config, []byte("platform_presets:\n  servers:\n    platforms: [linux/amd64]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(filepath.Join(dir, "out.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(f *os.File) { os.Stdout = f }(os.Stdout)
+	os.Stdout = out
+
+	if _, err := runBrewup(t, "presets", "--config", config, "--format", "json"); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	b, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed map[string]platformPreset
+	if err := json.Unmarshal(b, &listed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := listed["servers"]; !ok {
+		t.Errorf("presets did not list the config file's preset:\n%s", b)
+	}
+	if _, ok := listed["goreleaser-default"]; !ok {
+		t.Errorf("presets did not list the built-in presets:\n%s", b)
+	}
+}
+
+func TestUnreplacedChecksumFails(t *testing.T) {
+	const base = "/interlynk-io/sbomasm/releases/download/v1.0.5/"
+	var rel githubRelease
+	rel.TagName = "v1.0.5"
+	rel.Assets = []githubAsset{{Name: "sbomasm_Linux_x86_64.tar.gz", BrowserDownloadURL: "https://github.com" + base + "sbomasm_Linux_x86_64.tar.gz"}}
+	serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/interlynk-io/sbomasm/releases/tags/v1.0.5" {
+			json.NewEncoder(w).Encode(rel)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	// The checksum isn't on the line after the url, so it can't be found.
+	formula := "class Sbomasm < Formula\n  version \"v1.0.4\"\n" +
+		"  url \"https://github.com/interlynk-io/sbomasm/releases/download/v1.0.4/sbomasm_Linux_x86_64.tar.gz\"\n" +
+		"  # pinned by hand\n  sha256 \"" + strings.Repeat("1", 64) + "\"\nend\n"
+	path := filepath.Join(t.TempDir(), "sbomasm.rb")
+	if err := os.WriteFile(path, []byte(formula), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runBrewup(t, "-f", path, "-v", "v1.0.5", "--platforms", "linux/amd64", "--asset-glob", "{repo}_{Os}_{arch_alias}.tar.gz")
+	if err == nil || !strings.Contains(err.Error(), "could not be found to replace") {
+		t.Fatalf("err = %v, want the unreplaced checksum to fail", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != formula {
+		t.Errorf("formula was written:\n%s", b)
+	}
+}
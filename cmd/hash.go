@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/zeebo/blake3"
+)
+
+// hashAlgo is a checksum algorithm brewup can compute. Its name doubles as
+// the formula keyword the checksum is written under, e.g. sha256 "...".
+type hashAlgo struct {
+	name string
+	new  func() hash.Hash
+}
+
+// hexLen returns the length of a hex-encoded checksum for the algorithm, so
+// formula regexes match exactly one checksum of the right size.
+func (a hashAlgo) hexLen() int {
+	return a.new().Size() * 2
+}
+
+// isEmptyInput reports whether sum is the checksum of zero bytes, which
+// means a download came back empty rather than a real binary.
+func (a hashAlgo) isEmptyInput(sum string) bool {
+	return sum == fmt.Sprintf("%x", a.new().Sum(nil))
+}
+
+var hashAlgos = map[string]hashAlgo{}
+
+// registerHash makes an algorithm available to --algo.
+func registerHash(name string, newFn func() hash.Hash) {
+	hashAlgos[name] = hashAlgo{name: name, new: newFn}
+}
+
+func init() {
+	registerHash("sha256", sha256.New)
+	registerHash("sha384", sha512.New384)
+	registerHash("sha512", sha512.New)
+	registerHash("blake3", func() hash.Hash { return blake3.New() })
+}
+
+// selectedHash returns the algorithm chosen with --algo.
+func selectedHash() (hashAlgo, error) {
+	a, ok := hashAlgos[algo]
+	if !ok {
+		return hashAlgo{}, fmt.Errorf("unsupported checksum algorithm %q (supported: %s)", algo, strings.Join(hashNames(), ", "))
+	}
+	return a, nil
+}
+
+// extraAlgos are the algorithms of the config file's algorithms list other
+// than --algo. Their checksum lines follow the --algo one in every url
+// block.
+var extraAlgos []hashAlgo
+
+// extraHashes returns the algorithms the config file lists besides a.
+func extraHashes(a hashAlgo) ([]hashAlgo, error) {
+	if len(cfg.Algorithms) == 0 {
+		return nil, nil
+	}
+	var extra []hashAlgo
+	listed := false
+	for _, name := range cfg.Algorithms {
+		x, ok := hashAlgos[name]
+		if !ok {
+			return nil, fmt.Errorf("config file: algorithms: unsupported checksum algorithm %q (supported: %s)", name, strings.Join(hashNames(), ", "))
+		}
+		if name == a.name {
+			listed = true
+			continue
+		}
+		extra = append(extra, x)
+	}
+	if !listed {
+		return nil, fmt.Errorf("config file: algorithms %v does not list --algo %s", cfg.Algorithms, a.name)
+	}
+	return extra, nil
+}
+
+func hashNames() []string {
+	var names []string
+	for n := range hashAlgos {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
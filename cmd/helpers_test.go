@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// redirectTransport sends every request to a test server, keeping the
+// path, so formulas with their real GitHub urls can be updated against it.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host, req.Host = t.target.Scheme, t.target.Host, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// serve answers every request brewup sends with h until the test ends.
+func serve(t *testing.T, h http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	u, _ := url.Parse(srv.URL)
+	old := httpClient.Transport
+	SetTransport(redirectTransport{u})
+	t.Cleanup(func() {
+		srv.Close()
+		httpClient.Transport = old
+	})
+	return srv
+}
+
+// serveAssets serves the given bodies by url path, and 404 otherwise.
+func serveAssets(t *testing.T, assets map[string]string) *httptest.Server {
+	t.Helper()
+	return serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := assets[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+}
+
+// releaseAssets returns a body for each binary of sbomasm at tag, keyed by
+// url path.
+func releaseAssets(tag string) map[string]string {
+	assets := map[string]string{}
+	for _, p := range defaultPlatforms {
+		name := p.binaryName("sbomasm")
+		assets["/interlynk-io/sbomasm/releases/download/"+tag+"/"+name] = name + " " + tag
+	}
+	return assets
+}
+
+// copyExample copies a file of examples/ into a temporary directory and
+// returns its path there.
+func copyExample(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("..", "examples", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runBrewup runs brewup with args, every other flag at its default, and
+// returns what it logged.
+func runBrewup(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	resetFlags(rootCmd.Flags())
+
+	var out bytes.Buffer
+	oldLog := logOut
+	logOut = &out
+	defer func() { logOut = oldLog }()
+	rootCmd.SetArgs(args)
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+// changedLines returns the numbers of the lines that differ between a and
+// b, which must have as many lines.
+func changedLines(t *testing.T, a, b []byte) []int {
+	t.Helper()
+	al, bl := bytes.Split(a, []byte("\n")), bytes.Split(b, []byte("\n"))
+	if len(al) != len(bl) {
+		t.Fatalf("line count changed from %d to %d", len(al), len(bl))
+	}
+	var changed []int
+	for i := range al {
+		if !bytes.Equal(al[i], bl[i]) {
+			changed = append(changed, i+1)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// checkVersion runs --version-check-command before path is bumped from
+// oldVersion to the release tag, so an organization's policy can veto the
+// version, e.g. to allow only LTS releases. The command runs with sh -c and
+// gets the tag as $1 and BREWUP_TAG, the version without --tag-prefix as
+// BREWUP_VERSION, along with BREWUP_OLD_VERSION, BREWUP_REPO and
+// BREWUP_FILE. A non-zero exit aborts the update with the command's output.
+// Files already at the version are not checked.
+func checkVersion(path string, pr project, oldVersion, tag string) error {
+	if versionCheckCommand == "" || strings.TrimPrefix(oldVersion, "v") == strings.TrimPrefix(tagVersion(tag), "v") {
+		return nil
+	}
+
+	var out bytes.Buffer
+	c := exec.Command("sh", "-c", versionCheckCommand, "brewup", tag)
+	c.Env = append(os.Environ(),
+		"BREWUP_TAG="+tag,
+		"BREWUP_VERSION="+tagVersion(tag),
+		"BREWUP_OLD_VERSION="+oldVersion,
+		"BREWUP_REPO="+pr.String(),
+		"BREWUP_FILE="+path,
+	)
+	c.Stdout = &out
+	c.Stderr = &out
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("--version-check-command rejected %s: %w\n%s", tag, err, strings.TrimSpace(out.String()))
+	}
+	if verbose {
+		logf("--version-check-command accepted %s\n", tag)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// runSummary is the result of a brewup run, printed with --format json.
+type runSummary struct {
+	Formulas []formulaSummary `json:"formulas" desc:"One entry per processed formula file, in processing order"`
+
+	BytesDownloaded int64 `json:"bytes_downloaded" desc:"Bytes received by all downloads of the run, including retries and checksums files"`
+}
+
+// formulaSummary is the result of updating or checking one formula file.
+type formulaSummary struct {
+	File        string            `json:"file" desc:"Path to the formula file"`
+	Repo        string            `json:"repo,omitempty" desc:"GitHub repository the binaries are released from, as org/repo"`
+	OldVersion  string            `json:"old_version,omitempty" desc:"Version the formula had before the run"`
+	NewVersion  string            `json:"new_version,omitempty" desc:"Version the formula was updated to; empty in check mode"`
+	ReleaseName string            `json:"release_name,omitempty" desc:"Name of the upstream release, when resolved through the GitHub API"`
+	ReleaseURL  string            `json:"release_url,omitempty" desc:"Web page of the upstream release and its notes, when resolved through the GitHub API"`
+	Status      string            `json:"status" desc:"One of updated, up to date, ok, failed"`
+	Error       string            `json:"error,omitempty" desc:"Why processing failed, when status is failed"`
+	Platforms   []platformSummary `json:"platforms,omitempty" desc:"Per-platform checksum results"`
+
+	ReleaseDigest string `json:"release_digest,omitempty" desc:"sha256 over the sorted \"<platform>  <checksum>\" lines of every platform, as sha256:<hex>"`
+}
+
+// platformSummary is the result for one platform's binary.
+type platformSummary struct {
+	Platform    string `json:"platform" desc:"Platform as os-arch, e.g. darwin-arm64"`
+	URL         string `json:"url" desc:"URL the checksum was computed from, with pre-signed URL signatures redacted"`
+	OldChecksum string `json:"old_checksum,omitempty" desc:"Checksum the formula had before the run"`
+	NewChecksum string `json:"new_checksum,omitempty" desc:"Checksum computed from the downloaded binary"`
+	Status      string `json:"status" desc:"One of updated, unchanged, skipped, pruned, ok, mismatch, missing"`
+
+	BytesDownloaded int64 `json:"bytes_downloaded,omitempty" desc:"Bytes received downloading this platform's binary, including retries"`
+
+	OtherChecksums []checksumSummary `json:"other_checksums,omitempty" desc:"Checksums with the other algorithms of the config file's algorithms list"`
+}
+
+// checksumSummary is the result for one more checksum of a platform's
+// binary.
+type checksumSummary struct {
+	Algorithm   string `json:"algorithm" desc:"Checksum algorithm, e.g. sha512"`
+	OldChecksum string `json:"old_checksum,omitempty" desc:"Checksum the formula had before the run"`
+	NewChecksum string `json:"new_checksum,omitempty" desc:"Checksum computed from the downloaded binary"`
+}
+
+// logOut receives the human-readable progress output. It is stdout for
+// --format text and stderr otherwise, keeping stdout parseable.
+var logOut io.Writer = os.Stdout
+
+func logf(format string, args ...any) {
+	fmt.Fprintf(logOut, format, args...)
+}
+
+func logln(args ...any) {
+	fmt.Fprintln(logOut, args...)
+}
+
+// defaultSuccessTemplate is printed for each formula written.
+const defaultSuccessTemplate = "Successfully updated {{.File}}"
+
+// successTmpl and failureTmpl are the parsed --success-template and
+// --failure-template. failureTmpl is nil unless set, since failures are
+// already reported as errors.
+var successTmpl, failureTmpl *template.Template
+
+// messageData is what --success-template and --failure-template can refer
+// to.
+type messageData struct {
+	File       string
+	Repo       string
+	OldVersion string
+	Version    string
+	Platforms  int
+	Error      string
+}
+
+// parseMessageTemplates parses --success-template and --failure-template
+// and renders them once with empty data, so mistakes such as unknown fields
+// are reported before anything is downloaded.
+func parseMessageTemplates() error {
+	var err error
+	if successTmpl, err = parseMessageTemplate("success", successTemplate); err != nil {
+		return err
+	}
+	failureTmpl = nil
+	if failureTemplate != "" {
+		failureTmpl, err = parseMessageTemplate("failure", failureTemplate)
+	}
+	return err
+}
+
+func parseMessageTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Parse(text)
+	if err == nil {
+		err = t.Execute(io.Discard, messageData{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s-template: %w", name, err)
+	}
+	return t, nil
+}
+
+// logMessage prints t for the formula at path.
+func logMessage(t *template.Template, path string, s formulaSummary) {
+	if t == nil {
+		return
+	}
+	var b strings.Builder
+	data := messageData{File: path, Repo: s.Repo, OldVersion: s.OldVersion, Version: s.NewVersion, Platforms: len(s.Platforms), Error: s.Error}
+	if err := t.Execute(&b, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to render --%s-template: %v\n", t.Name(), err)
+		return
+	}
+	logln(b.String())
+}
+
+// printSummary writes the run summary in the selected --format. Text
+// output only lists files when several were processed; a single file's
+// progress output already says everything.
+func printSummary(s runSummary) error {
+	switch format {
+	case "json":
+		if s.Formulas == nil {
+			s.Formulas = []formulaSummary{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case "markdown":
+		printMarkdown(os.Stdout, s)
+		return nil
+	case "github":
+		printGitHubComment(os.Stdout, s)
+		return nil
+	default:
+		if len(s.Formulas) < 2 {
+			return nil
+		}
+		fmt.Println("Summary:")
+		for _, f := range s.Formulas {
+			status := f.Status
+			if f.Error != "" {
+				status += ": " + f.Error
+			}
+			fmt.Printf("  %s: %s\n", f.File, status)
+		}
+		return nil
+	}
+}
+
+// printMarkdown writes the summary as markdown, e.g. for a pull request
+// description: one section per formula with a link to the upstream release
+// notes and a table of checksums.
+func printMarkdown(w io.Writer, s runSummary) {
+	for i, f := range s.Formulas {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "### %s\n\n", f.File)
+		fmt.Fprintln(w, formulaHeadline(f))
+		printFormulaDetails(w, f)
+	}
+}
+
+// printGitHubComment writes the summary as a GitHub pull request comment: a
+// one-line tally on top, and each formula's details collapsed in a
+// <details> block so the comment stays short.
+func printGitHubComment(w io.Writer, s runSummary) {
+	counts := map[string]int{}
+	for _, f := range s.Formulas {
+		counts[f.Status]++
+	}
+	var parts []string
+	for _, status := range []string{"updated", "up to date", "ok", "failed"} {
+		if n := counts[status]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "no formulas processed")
+	}
+	fmt.Fprintf(w, "**brewup**: %s\n", strings.Join(parts, ", "))
+
+	for _, f := range s.Formulas {
+		// Markdown inside <summary> isn't rendered, so drop the backticks.
+		headline := strings.ReplaceAll(formulaHeadline(f), "`", "")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "<details>")
+		fmt.Fprintf(w, "<summary>%s — %s</summary>\n", html.EscapeString(f.File), html.EscapeString(headline))
+		printFormulaDetails(w, f)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "</details>")
+	}
+}
+
+// formulaHeadline describes the version change of a formula in one line.
+func formulaHeadline(f formulaSummary) string {
+	switch {
+	case f.NewVersion != "" && f.OldVersion != f.NewVersion:
+		return fmt.Sprintf("%s: `%s` → `%s` (%s)", f.Repo, f.OldVersion, f.NewVersion, f.Status)
+	case f.OldVersion != "":
+		return fmt.Sprintf("%s: `%s` (%s)", f.Repo, f.OldVersion, f.Status)
+	default:
+		return fmt.Sprintf("%s (%s)", f.Repo, f.Status)
+	}
+}
+
+// printFormulaDetails writes the release notes link, error and checksum
+// table of a formula, each preceded by a blank line.
+func printFormulaDetails(w io.Writer, f formulaSummary) {
+	if f.ReleaseURL != "" {
+		name := f.ReleaseName
+		if name == "" {
+			name = f.NewVersion
+		}
+		fmt.Fprintf(w, "\nRelease notes: [%s](%s)\n", name, f.ReleaseURL)
+	}
+	if f.Error != "" {
+		fmt.Fprintf(w, "\n```\n%s\n```\n", f.Error)
+	}
+	if len(f.Platforms) > 0 {
+		fmt.Fprintln(w)
+		printPlatformTable(w, f.Platforms)
+	}
+}
+
+func printPlatformTable(w io.Writer, platforms []platformSummary) {
+	fmt.Fprintln(w, "| Platform | Old checksum | New checksum | Status |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- |")
+	for _, p := range platforms {
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", p.Platform, markdownCode(p.OldChecksum), markdownCode(p.NewChecksum), p.Status)
+	}
+}
+
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + s + "`"
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// platformPreset is a named platform matrix, with the asset naming of the
+// release layout it is for.
+type platformPreset struct {
+	Description string   `yaml:"description" json:"description" desc:"One line shown by brewup presets"`
+	Platforms   []string `yaml:"platforms" json:"platforms" desc:"os/arch entries of the platform matrix, in order"`
+	AssetGlob   string   `yaml:"asset_glob" json:"asset_glob,omitempty" desc:"--asset-glob matching the layout's asset names; empty for <repo>-<os>-<arch>"`
+}
+
+// platformPresets are the built-in --platforms-preset values.
+var platformPresets = map[string]platformPreset{
+	"all-desktop": {
+		Description: "macOS and Linux on arm64 and amd64, the default matrix",
+		Platforms:   []string{"darwin/arm64", "darwin/amd64", "linux/arm64", "linux/amd64"},
+	},
+	"goreleaser-default": {
+		Description: "GoReleaser's default names, e.g. sbomasm_1.0.5_darwin_amd64.tar.gz or sbomasm_Darwin_x86_64.tar.gz",
+		Platforms:   []string{"darwin/arm64", "darwin/amd64", "linux/arm64", "linux/amd64"},
+		AssetGlob:   "{repo}_{*_{os}_{arch},{Os}_{arch_alias}}{,.tar.gz,.zip}",
+	},
+	"macos": {
+		Description: "macOS on arm64 and amd64",
+		Platforms:   []string{"darwin/arm64", "darwin/amd64"},
+	},
+	"linux": {
+		Description: "Linux on arm64 and amd64",
+		Platforms:   []string{"linux/arm64", "linux/amd64"},
+	},
+}
+
+// presets returns the built-in presets and the config file's
+// platform_presets, which replace built-in ones of the same name.
+func presets() map[string]platformPreset {
+	all := map[string]platformPreset{}
+	for name, pre := range platformPresets {
+		all[name] = pre
+	}
+	for name, pre := range cfg.PlatformPresets {
+		all[name] = pre
+	}
+	return all
+}
+
+// selectPlatforms sets the platform matrix of the run: --platforms when
+// passed, else the --platforms-preset one. A preset's asset naming sets
+// --asset-glob unless that was passed too.
+func selectPlatforms(flags *pflag.FlagSet) error {
+	platforms = defaultPlatforms
+	tokens := platformsFlag
+	if platformsPreset != "" {
+		pre, ok := presets()[platformsPreset]
+		if !ok {
+			return fmt.Errorf("unknown --platforms-preset %q (run brewup presets to list them)", platformsPreset)
+		}
+		if !flags.Changed("platforms") {
+			tokens = pre.Platforms
+		}
+		if pre.AssetGlob != "" && !flags.Changed("asset-glob") {
+			assetGlob = pre.AssetGlob
+		}
+	}
+	if len(tokens) == 0 {
+		if flags.Changed("platforms") {
+			return fmt.Errorf("--platforms must name at least one platform")
+		}
+		return nil
+	}
+
+	var matrix []platform
+	for _, token := range tokens {
+		p, err := splitPlatform(token)
+		if err != nil {
+			return fmt.Errorf("--platforms: %w", err)
+		}
+		for _, known := range matrix {
+			if known == p {
+				return fmt.Errorf("--platforms: %s is listed twice", token)
+			}
+		}
+		matrix = append(matrix, p)
+	}
+	platforms = matrix
+	return nil
+}
+
+var presetsFormat string
+
+var presetsCmd = &cobra.Command{
+	Use:   "presets",
+	Short: "List the platform matrices --platforms-preset can select",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Include the presets of the config file.
+		if err := loadConfig(cmd.Flags()); err != nil {
+			return err
+		}
+		switch presetsFormat {
+		case "text":
+			return printPresets(os.Stdout, presets())
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(presets())
+		default:
+			return fmt.Errorf("unsupported --format %q (supported: text, json)", presetsFormat)
+		}
+	},
+}
+
+func init() {
+	presetsCmd.Flags().StringVar(&presetsFormat, "format", "text", "Output format (text, json)")
+	rootCmd.AddCommand(presetsCmd)
+}
+
+func printPresets(w io.Writer, all map[string]platformPreset) error {
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PRESET\tPLATFORMS\tASSET GLOB\tDESCRIPTION")
+	for _, name := range names {
+		pre := all[name]
+		glob := pre.AssetGlob
+		if glob == "" {
+			glob = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, strings.Join(pre.Platforms, ","), glob, pre.Description)
+	}
+	return tw.Flush()
+}
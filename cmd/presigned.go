@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errSignatureExpired is returned when a pre-signed url is refused because
+// its signature expired, as opposed to missing permissions or rate limits.
+var errSignatureExpired = errors.New("pre-signed URL has expired (403); generate a new URL or pass --url-refresh-command")
+
+// signedQueryParams are the query parameters of pre-signed urls that carry
+// credentials, by lower-case name. They are redacted in output.
+var signedQueryParams = map[string]bool{
+	"x-amz-signature":      true,
+	"x-amz-credential":     true,
+	"x-amz-security-token": true,
+	"x-goog-signature":     true,
+	"x-goog-credential":    true,
+	"signature":            true,
+	"sig":                  true,
+	"policy":               true,
+	"key-pair-id":          true,
+	"token":                true,
+}
+
+// redactURL returns rawURL with the values of signature and credential
+// query parameters replaced, for logs and errors.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	q := u.Query()
+	redacted := false
+	for key := range q {
+		if signedQueryParams[strings.ToLower(key)] {
+			q.Set(key, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return rawURL
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// presignedURL reports whether rawURL carries signature or credential query
+// parameters, redacted or not.
+func presignedURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for key := range u.Query() {
+		if signedQueryParams[strings.ToLower(key)] {
+			return true
+		}
+	}
+	return false
+}
+
+// redactError returns err with the url of a failed request redacted, as
+// net/http names the full url in its errors.
+func redactError(err error) error {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	return &url.Error{Op: ue.Op, URL: redactURL(ue.URL), Err: ue.Err}
+}
+
+// forbiddenError explains a 403 response: a rate limit, an expired
+// pre-signed url, or missing permissions.
+func forbiddenError(rawURL string, resp *http.Response) error {
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		return fmt.Errorf("failed to download %s: rate limited (403); set GITHUB_TOKEN or retry later", redactURL(rawURL))
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if signatureExpired(rawURL, body, time.Now()) {
+		return fmt.Errorf("failed to download %s: %w", redactURL(rawURL), errSignatureExpired)
+	}
+	return fmt.Errorf("failed to download %s: access denied (403); check the URL's credentials and permissions", redactURL(rawURL))
+}
+
+// signatureExpired reports whether a 403 for rawURL is due to an expired
+// signature: the error body of S3, GCS or Azure says so, or the expiry
+// encoded in the url's query has passed.
+func signatureExpired(rawURL string, body []byte, now time.Time) bool {
+	lower := bytes.ToLower(body)
+	for _, msg := range []string{"request has expired", "expiredtoken", "signature expired", "signature has expired", "signature not valid in the specified time frame"} {
+		if bytes.Contains(lower, []byte(msg)) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	q := u.Query()
+	// AWS and GCS V4 signatures: signed at X-*-Date, valid for X-*-Expires
+	// seconds.
+	for _, vendor := range []string{"Amz", "Goog"} {
+		date, err := time.Parse("20060102T150405Z", q.Get("X-"+vendor+"-Date"))
+		if err != nil {
+			continue
+		}
+		secs, err := strconv.Atoi(q.Get("X-" + vendor + "-Expires"))
+		if err == nil && now.After(date.Add(time.Duration(secs)*time.Second)) {
+			return true
+		}
+	}
+	// CloudFront and S3 V2 signatures: Expires is a Unix time.
+	if secs, err := strconv.ParseInt(q.Get("Expires"), 10, 64); err == nil && now.After(time.Unix(secs, 0)) {
+		return true
+	}
+	// Azure SAS: se is the expiry time.
+	if se, err := time.Parse(time.RFC3339, q.Get("se")); err == nil && now.After(se) {
+		return true
+	}
+	return false
+}
+
+// refreshURL runs command, a --url-refresh-command, to get a fresh
+// pre-signed url for rawURL. The command runs with sh -c and BREWUP_URL set
+// to the expired url, and prints the new url on its first line of output.
+func refreshURL(command, rawURL string) (string, error) {
+	var stderr bytes.Buffer
+	c := exec.Command("sh", "-c", command)
+	c.Env = append(os.Environ(), "BREWUP_URL="+rawURL)
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("--url-refresh-command failed: %w\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "https://") && !strings.HasPrefix(line, "http://") {
+		return "", fmt.Errorf("--url-refresh-command printed %q, expected a URL", redactURL(line))
+	}
+	return line, nil
+}
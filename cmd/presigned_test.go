@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactURL(t *testing.T) {
+	got := redactURL("https://bucket.example.com/sbomasm-linux-amd64?X-Amz-Signature=secret&X-Amz-Expires=300")
+	if strings.Contains(got, "secret") || !strings.Contains(got, "X-Amz-Signature=REDACTED") {
+		t.Errorf("redactURL = %s", got)
+	}
+	plain := "https://github.com/interlynk-io/sbomasm/releases/download/v1.0.4/sbomasm-linux-amd64"
+	if got := redactURL(plain); got != plain {
+		t.Errorf("redactURL(%s) = %s", plain, got)
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	signed := srv.URL + "/sbomasm-linux-amd64?X-Amz-Signature=secret"
+	srv.Close()
+
+	_, err := http.Get(signed)
+	if err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+	if !strings.Contains(err.Error(), "secret") {
+		t.Fatalf("net/http no longer names the url in its errors: %v", err)
+	}
+	if msg := redactError(err).Error(); strings.Contains(msg, "secret") {
+		t.Errorf("redactError kept the signature: %s", msg)
+	}
+}
+
+func TestReproLogPresignedURL(t *testing.T) {
+	signed := "https://bucket.example.com/sbomasm-linux-amd64?X-Amz-Expires=300&X-Amz-Signature=secret"
+	body := "sbomasm-linux-amd64 v1.0.5"
+	serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("X-Amz-Signature") != "fresh" {
+			http.Error(w, "Request has expired", http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+
+	oldCommand := urlRefreshCommand
+	urlRefreshCommand = `echo "${BREWUP_URL%%\?*}?X-Amz-Signature=fresh"`
+	defer func() { urlRefreshCommand = oldCommand }()
+
+	a := hashAlgos["sha256"]
+	want, err := calculateChecksum(strings.Replace(signed, "secret", "fresh", 1), a, defaultDownloadOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := runSummary{Formulas: []formulaSummary{{
+		File:       "sbomasm.rb",
+		NewVersion: "1.0.5",
+		Status:     "updated",
+		Platforms:  []platformSummary{{Platform: "linux-amd64", URL: redactURL(signed), NewChecksum: want, Status: "updated"}},
+	}}}
+	path := filepath.Join(t.TempDir(), "repro.json")
+	if err := writeReproLog(path, s, a); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") || !strings.Contains(string(b), `"url_refresh_command"`) {
+		t.Fatalf("repro log:\n%s", b)
+	}
+
+	out, err := runBrewup(t, "--verify-repro", path)
+	if err != nil {
+		t.Fatalf("--verify-repro: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Checksum (sbomasm.rb 1.0.5 linux-amd64): OK") {
+		t.Errorf("--verify-repro logged:\n%s", out)
+	}
+}
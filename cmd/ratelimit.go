@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter paces reads so that all readers sharing it together stay
+// under a number of bytes per second.
+type rateLimiter struct {
+	bytesPerSec float64
+
+	mu   sync.Mutex
+	next time.Time // when the bandwidth reserved so far is used up
+}
+
+// wait blocks until n more bytes fit in the limit.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / l.bytesPerSec * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(d)
+}
+
+// downloadLimiter throttles every download when --limit-rate is set.
+var downloadLimiter *rateLimiter
+
+// limitedReader reads from r at the pace of l.
+type limitedReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// Read in small chunks, so concurrent downloads take turns instead of
+	// one of them reserving seconds of bandwidth at once.
+	if chunk := int(lr.l.bytesPerSec / 10); len(p) > chunk && chunk > 0 {
+		p = p[:chunk]
+	}
+	n, err := lr.r.Read(p)
+	lr.l.wait(n)
+	return n, err
+}
+
+// limitBody returns r throttled by --limit-rate, or r itself without one.
+func limitBody(r io.Reader) io.Reader {
+	if downloadLimiter == nil {
+		return r
+	}
+	return &limitedReader{r: r, l: downloadLimiter}
+}
+
+// parseRate parses a --limit-rate value such as 500K, 5MB/s or 1.5M, in
+// bytes per second. Units are powers of 1024, as in curl's --limit-rate.
+func parseRate(s string) (float64, error) {
+	num := strings.TrimSuffix(strings.TrimSpace(s), "/s")
+	num = strings.TrimSuffix(strings.TrimSuffix(num, "iB"), "B")
+	mult := 1.0
+	if num != "" {
+		switch num[len(num)-1] {
+		case 'k', 'K':
+			mult = 1 << 10
+		case 'm', 'M':
+			mult = 1 << 20
+		case 'g', 'G':
+			mult = 1 << 30
+		}
+		if mult != 1 {
+			num = num[:len(num)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid --limit-rate %q, expected a rate such as 500K or 5MB/s", s)
+	}
+	return v * mult, nil
+}
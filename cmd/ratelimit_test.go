@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"500", 500},
+		{"500K", 500 << 10},
+		{"5MB/s", 5 << 20},
+		{"1.5M", 1.5 * (1 << 20)},
+		{"2GiB", 2 << 30},
+		{"4k", 4 << 10},
+	}
+	for _, tt := range tests {
+		got, err := parseRate(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseRate(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "fast", "0", "-1M", "M"} {
+		if _, err := parseRate(in); err == nil {
+			t.Errorf("parseRate(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+// TestLimitRate downloads over a local server, which is far faster than
+// the limit, and checks the throughput the limit leaves.
+func TestLimitRate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("measures seconds of throttled downloads")
+	}
+	const rate = 2 << 20
+	body := bytes.Repeat([]byte("x"), 2<<20)
+	srv := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	downloadLimiter = &rateLimiter{bytesPerSec: rate}
+	t.Cleanup(func() { downloadLimiter = nil })
+
+	tests := []struct {
+		name      string
+		downloads int
+	}{
+		{"one download", 1},
+		// The limit is shared: two downloads together take twice as long.
+		{"two downloads", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetURLCache()
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < tt.downloads; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					name, err := downloadAsset(srv.URL+"/asset", defaultDownloadOptions())
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					os.Remove(name)
+				}()
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+
+			// Reads take a tenth of a second of bandwidth at a time, so the
+			// last one may return before its share has passed.
+			want := time.Duration(float64(tt.downloads*len(body)) / rate * float64(time.Second))
+			if elapsed < want-200*time.Millisecond || elapsed > want+time.Second {
+				t.Errorf("downloading %d x %d bytes at %d bytes/s took %v, want about %v", tt.downloads, len(body), rate, elapsed, want)
+			}
+		})
+	}
+}
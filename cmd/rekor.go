@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// defaultRekorURL is the public Sigstore transparency log.
+const defaultRekorURL = "https://rekor.sigstore.dev"
+
+// rekorEntry is the subset of a Rekor log entry brewup verifies.
+type rekorEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+	} `json:"verification"`
+}
+
+// rekorLog holds the public key of --rekor-url, fetched once per run.
+var rekorLog = struct {
+	sync.Mutex
+	key   crypto.PublicKey
+	logID string
+}{}
+
+// resetRekorLog forgets the log's key, so nothing is carried over between
+// runs.
+func resetRekorLog() {
+	rekorLog.Lock()
+	defer rekorLog.Unlock()
+	rekorLog.key, rekorLog.logID = nil, ""
+}
+
+// verifyRekorEntry implements --verify-rekor: it fails unless the Rekor log
+// has a valid entry for checksum, one whose body pins that digest, whose
+// log ID is the log's key and whose signed entry timestamp verifies with
+// it.
+func verifyRekorEntry(checksum string, a hashAlgo, log io.Writer) error {
+	if !verifyRekor {
+		return nil
+	}
+	digest := a.name + ":" + checksum
+
+	var uuids []string
+	if err := rekorPost("/api/v1/index/retrieve", map[string]string{"hash": digest}, &uuids); err != nil {
+		return fmt.Errorf("failed to search Rekor for %s: %w", digest, err)
+	}
+	if len(uuids) == 0 {
+		return fmt.Errorf("no Rekor entry found for %s", digest)
+	}
+
+	key, logID, err := rekorKey()
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for _, uuid := range uuids {
+		var entries map[string]rekorEntry
+		if err := rekorGet("/api/v1/log/entries/"+uuid, &entries); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", uuid, err))
+			continue
+		}
+		for id, e := range entries {
+			if err := checkRekorEntry(e, checksum, a, key, logID); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", id, err))
+				continue
+			}
+			if verbose {
+				fmt.Fprintf(log, "Found Rekor entry %s (log index %d) for %s\n", id, e.LogIndex, digest)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no valid Rekor entry found for %s: %s", digest, strings.Join(problems, "; "))
+}
+
+// checkRekorEntry checks that e pins checksum and is signed by the log.
+func checkRekorEntry(e rekorEntry, checksum string, a hashAlgo, key crypto.PublicKey, logID string) error {
+	body, err := base64.StdEncoding.DecodeString(e.Body)
+	if err != nil {
+		return fmt.Errorf("invalid entry body: %w", err)
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("invalid entry body: %w", err)
+	}
+	if !pinsDigest(v, a.name, checksum) {
+		return fmt.Errorf("entry does not record the %s %s", a.name, checksum)
+	}
+	if e.LogID != logID {
+		return fmt.Errorf("entry is from log %s, not %s", e.LogID, logID)
+	}
+
+	// The signed entry timestamp signs the canonical JSON of these fields,
+	// keys sorted.
+	var payload bytes.Buffer
+	enc := json.NewEncoder(&payload)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{e.Body, e.IntegratedTime, e.LogID, e.LogIndex}); err != nil {
+		return fmt.Errorf("failed to encode entry: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(e.Verification.SignedEntryTimestamp)
+	if err != nil || len(sig) == 0 {
+		return fmt.Errorf("entry has no signed entry timestamp")
+	}
+	if !verifySignature(key, bytes.TrimSuffix(payload.Bytes(), []byte("\n")), sig) {
+		return fmt.Errorf("signed entry timestamp does not verify with the log's key")
+	}
+	return nil
+}
+
+// pinsDigest reports whether v, a decoded entry body, holds a hash object
+// {"algorithm": algo, "value": checksum}, as the hashedrekord, rekord,
+// intoto and dsse entry kinds record the artifact's digest.
+func pinsDigest(v any, algo, checksum string) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		alg, _ := v["algorithm"].(string)
+		value, _ := v["value"].(string)
+		if strings.EqualFold(alg, algo) && strings.EqualFold(value, checksum) {
+			return true
+		}
+		for _, c := range v {
+			if pinsDigest(c, algo, checksum) {
+				return true
+			}
+		}
+	case []any:
+		for _, c := range v {
+			if pinsDigest(c, algo, checksum) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func verifySignature(key crypto.PublicKey, payload, sig []byte) bool {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(payload)
+		return ecdsa.VerifyASN1(key, sum[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, sig)
+	}
+	return false
+}
+
+// rekorKey returns the public key of --rekor-url and the log ID it signs
+// entries as, the hex sha256 of the key.
+func rekorKey() (crypto.PublicKey, string, error) {
+	rekorLog.Lock()
+	defer rekorLog.Unlock()
+	if rekorLog.key != nil {
+		return rekorLog.key, rekorLog.logID, nil
+	}
+
+	b, err := rekorFetch(http.MethodGet, "/api/v1/log/publicKey", nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch Rekor public key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, "", fmt.Errorf("failed to parse Rekor public key: no PEM block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse Rekor public key: %w", err)
+	}
+	sum := sha256.Sum256(block.Bytes)
+	rekorLog.key, rekorLog.logID = key, hex.EncodeToString(sum[:])
+	return rekorLog.key, rekorLog.logID, nil
+}
+
+func rekorGet(path string, v any) error {
+	b, err := rekorFetch(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func rekorPost(path string, body, v any) error {
+	in, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	b, err := rekorFetch(http.MethodPost, path, in)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// rekorFetch sends a request to the Rekor API at --rekor-url and returns
+// the response body.
+func rekorFetch(method, path string, body []byte) ([]byte, error) {
+	url := strings.TrimSuffix(rekorURL, "/") + path
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", redactURL(url), err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, redactError(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	return b, nil
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// reproLog records the inputs and results of a run so they can be
+// re-verified later with --verify-repro. Fields and entries are always
+// written in the same order, so two logs of the same run differ only in
+// their timestamp.
+type reproLog struct {
+	Tool        string         `json:"tool"`
+	ToolVersion string         `json:"tool_version"`
+	Timestamp   string         `json:"timestamp"`
+	Algorithm   string         `json:"algorithm"`
+	Formulas    []reproFormula `json:"formulas"`
+}
+
+type reproFormula struct {
+	File    string       `json:"file"`
+	Repo    string       `json:"repo"`
+	Version string       `json:"version"`
+	Assets  []reproAsset `json:"assets"`
+
+	ReleaseDigest string `json:"release_digest,omitempty"`
+}
+
+type reproAsset struct {
+	Platform string `json:"platform"`
+	URL      string `json:"url"`
+	Checksum string `json:"checksum"`
+
+	// URLRefreshCommand is the --url-refresh-command of the run, recorded
+	// for pre-signed urls: their signature is redacted in the log and would
+	// have expired by --verify-repro time anyway.
+	URLRefreshCommand string `json:"url_refresh_command,omitempty"`
+}
+
+// toolVersion returns brewup's module version, or "(devel)" for builds
+// outside of go install.
+func toolVersion() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" {
+		return bi.Main.Version
+	}
+	return "(devel)"
+}
+
+// writeReproLog writes the checksums computed in a run to path. Files that
+// failed are left out, as are platforms that were not downloaded.
+func writeReproLog(path string, s runSummary, a hashAlgo) error {
+	l := reproLog{
+		Tool:        "brewup",
+		ToolVersion: toolVersion(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Algorithm:   a.name,
+		Formulas:    []reproFormula{},
+	}
+	for _, f := range s.Formulas {
+		if f.Status == "failed" {
+			continue
+		}
+		rf := reproFormula{File: f.File, Repo: f.Repo, Version: f.NewVersion, Assets: []reproAsset{}, ReleaseDigest: f.ReleaseDigest}
+		if rf.Version == "" {
+			rf.Version = f.OldVersion
+		}
+		for _, p := range f.Platforms {
+			if p.NewChecksum == "" {
+				continue
+			}
+			asset := reproAsset{Platform: p.Platform, URL: p.URL, Checksum: p.NewChecksum}
+			if presignedURL(p.URL) {
+				asset.URLRefreshCommand = urlRefreshCommand
+			}
+			rf.Assets = append(rf.Assets, asset)
+		}
+		l.Formulas = append(l.Formulas, rf)
+	}
+
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode reproducibility log: %w", err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write reproducibility log: %w", err)
+	}
+	return nil
+}
+
+// verifyReproLog downloads every asset recorded in the log at path again
+// and checks that it still has the recorded checksum. Pre-signed urls are
+// first refreshed with the recorded command, or --url-refresh-command when
+// it is set.
+func verifyReproLog(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read reproducibility log: %w", err)
+	}
+	var l reproLog
+	if err := json.Unmarshal(b, &l); err != nil {
+		return fmt.Errorf("failed to parse reproducibility log %s: %w", path, err)
+	}
+	a, ok := hashAlgos[l.Algorithm]
+	if !ok {
+		return fmt.Errorf("reproducibility log %s uses unsupported checksum algorithm %q", path, l.Algorithm)
+	}
+
+	logf("Verifying %s (brewup %s, %s):\n", path, l.ToolVersion, l.Timestamp)
+	mismatches := 0
+	for _, f := range l.Formulas {
+		for _, asset := range f.Assets {
+			url := asset.URL
+			if presignedURL(url) {
+				command := urlRefreshCommand
+				if command == "" {
+					command = asset.URLRefreshCommand
+				}
+				if command == "" {
+					return fmt.Errorf("%s is pre-signed and %s records no url refresh command for it; set --url-refresh-command", redactURL(url), path)
+				}
+				if url, err = refreshURL(command, url); err != nil {
+					return fmt.Errorf("failed to refresh %s: %w", redactURL(asset.URL), err)
+				}
+			}
+			got, err := calculateChecksum(url, a, defaultDownloadOptions())
+			if err != nil {
+				return fmt.Errorf("failed to calculate checksum for %s: %w", redactURL(asset.URL), err)
+			}
+			if got != asset.Checksum {
+				mismatches++
+				logf("Checksum (%s %s %s): MISMATCH log has %s, asset has %s\n", f.File, f.Version, asset.Platform, asset.Checksum, got)
+				continue
+			}
+			logf("Checksum (%s %s %s): OK\n", f.File, f.Version, asset.Platform)
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d checksum(s) do not match %s", mismatches, path)
+	}
+	return nil
+}
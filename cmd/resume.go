@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkpoint is the --resume-from-file state: the files a run completed, in
+// the order it completed them. Files that failed are not recorded, so a
+// rerun tries them again.
+type checkpoint struct {
+	Completed []checkpointEntry `json:"completed"`
+}
+
+// checkpointEntry is one completed file: its summary, reported again by the
+// run that skips it, and the change it added to --patch-out, if any. Mode
+// and Request are those of the run that completed it; only a run with the
+// same ones skips the file.
+type checkpointEntry struct {
+	Mode    string         `json:"mode"`
+	Request string         `json:"request"`
+	Summary formulaSummary `json:"summary"`
+	Patch   string         `json:"patch,omitempty"`
+}
+
+// checkpointMode names what a run does to the files it completes, so a
+// --dry-run or --check does not stand in for an update.
+func checkpointMode() string {
+	switch {
+	case check:
+		return "check"
+	case dryRun:
+		return "dry-run"
+	}
+	return "update"
+}
+
+// checkpointRequest names the version a run asked for, with --tag-prefix:
+// the --version, the --version-range, or latest for each repository's
+// latest release.
+func checkpointRequest() string {
+	switch {
+	case version != "":
+		return tagPrefix + version
+	case versionRangeStr != "":
+		return tagPrefix + "range " + versionRangeStr
+	}
+	return tagPrefix + "latest"
+}
+
+// checkpointCurrent reports whether an update of path would still resolve
+// to the version e recorded. Only --version pins it; a range or the latest
+// release may have moved on since, which is checked through the GitHub API
+// without downloading anything.
+func checkpointCurrent(e checkpointEntry, path string, rng versionRange) bool {
+	if version != "" || check {
+		return true
+	}
+	_, pr, err := readFormula(path)
+	if err != nil {
+		return false
+	}
+	rel, err := resolveRelease(pr, rng)
+	if err != nil {
+		return false
+	}
+	// Scoop manifests record the version without its "v".
+	return strings.TrimPrefix(tagVersion(rel.TagName), "v") == strings.TrimPrefix(e.Summary.NewVersion, "v")
+}
+
+// loadCheckpoint reads the checkpoint at path. A missing file is an empty
+// checkpoint, so the first run of a batch starts one.
+func loadCheckpoint(path string) (checkpoint, error) {
+	var c checkpoint
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// done returns the entry of file if an earlier run with the same mode and
+// request completed it.
+func (c *checkpoint) done(file, mode, request string) (checkpointEntry, bool) {
+	// The latest entry wins, as a file may be recorded again once the
+	// release it resolves to moves on.
+	for i := len(c.Completed) - 1; i >= 0; i-- {
+		e := c.Completed[i]
+		if filepath.Clean(e.Summary.File) == filepath.Clean(file) && e.Mode == mode && e.Request == request {
+			return e, true
+		}
+	}
+	return checkpointEntry{}, false
+}
+
+// record adds e to the checkpoint and writes it to path. The file is
+// replaced by a rename, so an interrupted write leaves the previous
+// checkpoint in place rather than a truncated one.
+func (c *checkpoint) record(path string, e checkpointEntry) error {
+	c.Completed = append(c.Completed, e)
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
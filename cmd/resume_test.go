@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResumeAfterDryRun(t *testing.T) {
+	serveAssets(t, releaseAssets("v1.0.5"))
+	path := copyExample(t, "sbomasm.rb")
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := filepath.Join(t.TempDir(), "state.json")
+
+	// A failing second file keeps the checkpoint of the first.
+	broken := filepath.Join(filepath.Dir(path), "broken.rb")
+	if err := os.WriteFile(broken, []byte("class Broken < Formula\nend\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runBrewup(t, "--formula-dir", filepath.Dir(path), "-v", "v1.0.5", "--dry-run", "--resume-from-file", state); err == nil {
+		t.Fatal("expected the broken formula to fail")
+	}
+	cp, err := loadCheckpoint(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Completed) != 1 || cp.Completed[0].Mode != "dry-run" || cp.Completed[0].Request != "v1.0.5" {
+		t.Fatalf("checkpoint = %+v, want the dry run of %s", cp.Completed, path)
+	}
+
+	os.Remove(broken)
+	log, err := runBrewup(t, "--formula-dir", filepath.Dir(path), "-v", "v1.0.5", "--resume-from-file", state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(log, "Skipping") {
+		t.Errorf("the update skipped a file only dry-run before:\n%s", log)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b, orig) || !bytes.Contains(b, []byte("v1.0.5")) {
+		t.Errorf("formula was not updated:\n%s", b)
+	}
+}
+
+func TestCheckpointDone(t *testing.T) {
+	cp := checkpoint{Completed: []checkpointEntry{
+		{Mode: "update", Request: "v1.0.5", Summary: formulaSummary{File: "Formula/./sbomasm.rb"}},
+		{Mode: "update", Request: "range ^1.2.0", Summary: formulaSummary{File: "Formula/sbomasm.rb"}},
+	}}
+	tests := []struct {
+		file, mode, request string
+		want                bool
+	}{
+		{"Formula/sbomasm.rb", "update", "v1.0.5", true},
+		{"Formula/sbomasm.rb", "dry-run", "v1.0.5", false},
+		{"Formula/sbomasm.rb", "check", "v1.0.5", false},
+		{"Formula/sbomasm.rb", "update", "v1.0.6", false},
+		{"Formula/sbomasm.rb", "update", "latest", false},
+		{"Formula/sbomasm.rb", "update", "range ^1.2.0", true},
+		{"Formula/sbomasm.rb", "update", "range ^2.0.0", false},
+		{"Formula/sbomqs.rb", "update", "v1.0.5", false},
+	}
+	for _, tt := range tests {
+		if _, got := cp.done(tt.file, tt.mode, tt.request); got != tt.want {
+			t.Errorf("done(%s, %s, %q) = %v, want %v", tt.file, tt.mode, tt.request, got, tt.want)
+		}
+	}
+}
+
+func TestResumeLatestMovedOn(t *testing.T) {
+	latest := "v1.0.5"
+	assets := releaseAssets("v1.0.5")
+	serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/interlynk-io/sbomasm/releases/latest" {
+			fmt.Fprintf(w, `{"tag_name": %q}`, latest)
+			return
+		}
+		body, ok := assets[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	path := copyExample(t, "sbomasm.rb")
+	state := filepath.Join(t.TempDir(), "state.json")
+
+	// An earlier latest run, when v1.0.4 was the latest release.
+	cp := checkpoint{}
+	if err := cp.record(state, checkpointEntry{Mode: "update", Request: "latest", Summary: formulaSummary{File: path, NewVersion: "v1.0.4", Status: "up to date"}}); err != nil {
+		t.Fatal(err)
+	}
+	log, err := runBrewup(t, "-f", path, "--resume-from-file", state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(log, "Skipping") {
+		t.Errorf("skipped a file recorded at v1.0.4 though the latest release is v1.0.5:\n%s", log)
+	}
+	if b, _ := os.ReadFile(path); !bytes.Contains(b, []byte(`version "v1.0.5"`)) {
+		t.Errorf("formula was not updated:\n%s", b)
+	}
+
+	// Recorded at the latest release, the file is skipped.
+	cp = checkpoint{}
+	if err := cp.record(state, checkpointEntry{Mode: "update", Request: "latest", Summary: formulaSummary{File: path, NewVersion: "v1.0.5", Status: "updated"}}); err != nil {
+		t.Fatal(err)
+	}
+	if log, err = runBrewup(t, "-f", path, "--resume-from-file", state); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log, "Skipping") {
+		t.Errorf("did not skip a file recorded at the latest release:\n%s", log)
+	}
+}
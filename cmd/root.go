@@ -1,40 +1,194 @@
 package cmd
 
 import (
-	"crypto/sha256"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"io/fs"
 	"os"
-	"regexp"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
-	repoName string
-	version  string
-	filePath string
-	dryRun   bool
+	repoName    string
+	orgName     string
+	formulaName string
+	version     string
+
+	versionRangeStr string
+	tagPrefix       string
+	versionMap      map[string]string
+	filePath        string
+	formulaEncoding string
+	dryRun          bool
+	patchOut        string
+	diffContext     int
+
+	contextLinesInError int
+
+	retries             int
+	maxRedirects        int
+	urlRefreshCommand   string
+	versionCheckCommand string
+	downloadDir         string
+
+	concurrencyFlag     string
+	parallelChunks      int
+	concurrency         int
+	limitRate           string
+	deterministicOutput bool
+	reportBandwidth     bool
+
+	check           bool
+	failIfUnchanged bool
+	noClobber       bool
+	changed         string
+
+	algo string
+
+	scoop bool
+
+	formulaDir     string
+	recursive      bool
+	resumeFromFile string
+
+	format string
+
+	canonical        bool
+	checksumComments bool
+	digestComment    bool
+	updateTest       bool
+	updateCaveats    bool
+	updateDepends    []string
+	force            bool
+	backup           bool
+	audit            bool
+	runTest          bool
+
+	ignore  []string
+	ignored map[platform]bool
+
+	platformsFlag   []string
+	platformsPreset string
+
+	assetGlob     string
+	strict        bool
+	requireAll    bool
+	expectOrgRepo bool
+	verifyRekor   bool
+	rekorURL      string
+
+	checksumsURL         string
+	checksumsStripPrefix string
+	assumeChecksums      bool
+	checksumsCandidates  []string
+	on404                string
+
+	timeout    time.Duration
+	verbose    bool
+	configFile string
+	showCfg    bool
+
+	reproLogPath    string
+	verifyReproPath string
+
+	selftest bool
+
+	tapJSON      bool
+	outdatedOnly bool
+
+	successTemplate string
+	failureTemplate string
 )
 
+// defaultOrg is the GitHub organization used when it can't be inferred.
+const defaultOrg = "interlynk-io"
+
 var rootCmd = &cobra.Command{
 	Use:   "brewup",
 	Short: "Update Homebrew formula with new version and checksums",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return updateFormula()
+		return run(cmd)
 	},
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&repoName, "repo", "r", "", "Repository name (e.g., sbomasm)")
-	rootCmd.Flags().StringVarP(&version, "version", "v", "", "Version tag (e.g., v1.0.5)")
+	rootCmd.Flags().StringVarP(&repoName, "repo", "r", "", "Repository name (e.g., sbomasm); inferred from the formula's URLs when unset")
+	rootCmd.Flags().StringVar(&formulaName, "formula-name", "", "Formula name, when it differs from the repository name; used for the class name and file name (default: --repo)")
+	rootCmd.Flags().StringVar(&orgName, "org", "", "GitHub organization (default: inferred from the formula's URLs, or "+defaultOrg+")")
+	rootCmd.Flags().StringVarP(&version, "version", "v", "", "Version tag (e.g., v1.0.5); defaults to each repository's latest release")
+	rootCmd.Flags().StringVar(&versionRangeStr, "version-range", "", "Use the highest released version matching an npm-style range (e.g., ^1.2.0, ~1.2.3)")
+	rootCmd.Flags().StringVar(&tagPrefix, "tag-prefix", "", "Prefix of the release tags in front of the version, for monorepos tagging per subproject (e.g., subproject/)")
+	rootCmd.Flags().StringToStringVar(&versionMap, "version-map", nil, "Formula version to write for a release version, when they differ (e.g., v1.2.3=1.2.3_1); repeatable or comma-separated")
 	rootCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to Homebrew formula file (e.g., sbomasm.rb)")
+	rootCmd.Flags().StringVar(&formulaEncoding, "formula-encoding", "bytes", "How formula files are read: bytes keeps any bytes as they are, utf-8 rejects files that aren't valid UTF-8")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the file")
-	rootCmd.MarkFlagRequired("repo")
-	rootCmd.MarkFlagRequired("version")
-	rootCmd.MarkFlagRequired("file")
+	rootCmd.Flags().StringVar(&patchOut, "patch-out", "", "Write the changes as a unified diff to this file instead of modifying the formulas")
+	rootCmd.Flags().IntVar(&contextLinesInError, "context-lines-in-error", 3, "Number of formula lines to show around where a platform's url block was expected when none matches (0 to disable)")
+	rootCmd.Flags().IntVar(&diffContext, "diff-context", 3, "Number of context lines around each change in --patch-out")
+	rootCmd.Flags().IntVar(&retries, "retries", 3, "Number of times to retry a failed download, resuming partial downloads when possible")
+	rootCmd.Flags().IntVar(&maxRedirects, "max-redirects", 10, "Maximum number of redirects to follow for one request")
+	rootCmd.Flags().StringVar(&urlRefreshCommand, "url-refresh-command", "", "Shell command printing a fresh pre-signed URL for $BREWUP_URL, run once when a download's signature has expired")
+	rootCmd.Flags().StringVar(&concurrencyFlag, "concurrency", "auto", "Number of binaries to download in parallel, or auto to size it from the platform count and CPUs")
+	rootCmd.Flags().BoolVar(&deterministicOutput, "deterministic-output", false, "Print output in the same order on every run, with platforms sorted by os then arch, whatever the order downloads finish in")
+	rootCmd.Flags().BoolVar(&reportBandwidth, "report-bandwidth", false, "Print the total bytes downloaded at the end of the run, and per platform with --verbose")
+	rootCmd.Flags().IntVar(&parallelChunks, "parallel-chunks", 1, "Download each binary as this many byte ranges at once, when the server supports ranges (1 disables)")
+	rootCmd.Flags().StringVar(&limitRate, "limit-rate", "", "Limit the combined bandwidth of all downloads, e.g. 500K or 5MB/s (default: unlimited)")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 0, "Timeout for each download attempt, e.g. 5m (default: no timeout)")
+	rootCmd.Flags().StringVar(&downloadDir, "download-dir", "", "Directory to keep downloaded binaries in (default: temporary files)")
+	rootCmd.Flags().BoolVar(&check, "check", false, "Verify the formula's checksums against its current URLs without modifying it")
+	rootCmd.Flags().BoolVar(&noClobber, "no-clobber-unrelated-urls", false, "Fail instead of warning when an update would change a line with a URL of another project")
+	rootCmd.Flags().StringVar(&versionCheckCommand, "version-check-command", "", "Shell command run with the proposed tag as $1 before each bump; a non-zero exit rejects the version")
+	rootCmd.Flags().BoolVar(&failIfUnchanged, "fail-if-unchanged", false, "Exit non-zero when a file would be left unchanged, e.g. because it is already at the version")
+	rootCmd.Flags().StringVar(&changed, "changed", "", "Only process formulas changed in the given git range (default: working tree against HEAD)")
+	rootCmd.Flags().Lookup("changed").NoOptDefVal = "HEAD"
+	rootCmd.Flags().BoolVar(&scoop, "scoop", false, "Update a Scoop manifest instead of a Homebrew formula (implied for .json files)")
+	rootCmd.Flags().StringVar(&formulaDir, "formula-dir", "", "Process every .rb file in this directory")
+	rootCmd.Flags().BoolVar(&recursive, "recursive", false, "Search --formula-dir recursively")
+	rootCmd.Flags().StringVar(&resumeFromFile, "resume-from-file", "", "Record completed formulas in this checkpoint file and skip the ones it lists, to resume an interrupted batch run")
+	rootCmd.Flags().StringVar(&assetGlob, "asset-glob", "", "Find each platform's binary in the release's assets by glob; {repo}, {os}, {arch}, {version}, {Os} and {arch_alias} are replaced and {a,b} matches either (e.g., {repo}-*-{os}-{arch}*)")
+	rootCmd.Flags().BoolVar(&strict, "strict", true, "Fail when --asset-glob matches several assets instead of using the first")
+	rootCmd.Flags().BoolVar(&expectOrgRepo, "expected-org-repo-in-asset", false, "Before downloading, fail when an asset url's path doesn't contain the formula's <org>/<repo>")
+	rootCmd.Flags().BoolVar(&verifyRekor, "verify-rekor", false, "Fail unless each asset's checksum has a valid entry in the Sigstore Rekor transparency log (sha256 and sha512 only)")
+	rootCmd.Flags().StringVar(&rekorURL, "rekor-url", defaultRekorURL, "Rekor instance --verify-rekor searches")
+	rootCmd.Flags().BoolVar(&requireAll, "require-all-platforms", false, "Check the release's asset listing for every platform's binary before downloading, failing with the missing platforms")
+	rootCmd.Flags().StringVar(&checksumsURL, "checksums-url", "", "Read checksums from this checksums file instead of downloading each binary; {org}, {repo} and {version} are replaced")
+	rootCmd.Flags().StringVar(&checksumsStripPrefix, "checksums-strip-prefix", "", "Prefix to remove from file names in the checksums file (e.g., dist/)")
+	rootCmd.Flags().BoolVar(&assumeChecksums, "assume-checksums-file", false, "Look for a checksums file in the release under the --checksums-candidates names, and download each binary only if there is none")
+	rootCmd.Flags().StringSliceVar(&checksumsCandidates, "checksums-candidates", defaultChecksumsCandidates, "Checksums file names tried by --assume-checksums-file, in order; {repo}, {tag} and {version} (without the v) are replaced")
+	rootCmd.Flags().StringSliceVar(&platformsFlag, "platforms", nil, "Platform matrix to update, as os/arch entries (e.g., darwin/arm64,linux/amd64); replaces the --platforms-preset one")
+	rootCmd.Flags().StringVar(&platformsPreset, "platforms-preset", "", "Named platform matrix and asset naming for a common release layout (e.g., goreleaser-default); list them with brewup presets")
+	rootCmd.Flags().StringSliceVar(&ignore, "ignore", nil, "Platforms to leave untouched, as os/arch (e.g., darwin/amd64); repeatable or comma-separated")
+	rootCmd.Flags().StringVar(&on404, "on-404", on404Error, "What to do when a platform's asset is missing: error, skip, prune or warn")
+	rootCmd.Flags().BoolVar(&backup, "backup", false, "Save the original formula as <file>.bak before writing")
+	rootCmd.Flags().BoolVar(&audit, "audit", false, "Run 'brew audit --formula' on the updated formula, failing on audit errors (skipped if brew is not installed)")
+	rootCmd.Flags().BoolVar(&runTest, "run-test", false, "Run 'brew test' on the updated formula, restoring the original on failure (skipped if brew is not installed)")
+	rootCmd.Flags().BoolVar(&force, "force", false, "Update the formula even if its URLs reference a different repository than --org/--repo")
+	rootCmd.Flags().BoolVar(&updateTest, "update-test-version", false, "Also replace the old version with the new one inside the formula's test block")
+	rootCmd.Flags().BoolVar(&updateCaveats, "update-caveats-version", false, "Also replace the old version with the new one inside the formula's caveats")
+	rootCmd.Flags().StringSliceVar(&updateDepends, "update-depends", nil, "Also move the version constraint of the named dependency (depends_on \"name\" => \"1.2.3\") from the old version to the new one (repeatable)")
+	rootCmd.Flags().BoolVar(&checksumComments, "checksum-comment", false, "Append a comment with the URL each checksum was computed from to its line")
+	rootCmd.Flags().BoolVar(&digestComment, "release-digest", false, "Record a digest over all platform checksums in a comment after the version line")
+	rootCmd.Flags().BoolVar(&canonical, "canonicalize", false, "Normalize the order and indentation of the formula's platform blocks")
+	rootCmd.Flags().BoolVar(&verbose, "verbose", false, "Print details such as download retries")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Path to a config file (default: "+defaultConfigFile+" if present)")
+	rootCmd.Flags().StringVar(&reproLogPath, "repro-log", "", "Record the resolved versions, URLs and checksums of the run in this file, for --verify-repro")
+	rootCmd.Flags().StringVar(&verifyReproPath, "verify-repro", "", "Download every asset recorded in a --repro-log file again and verify its checksum, without touching formulas")
+	rootCmd.Flags().BoolVar(&showCfg, "show-config", false, "Print the effective configuration after merging flags, environment and config file, and exit")
+	rootCmd.Flags().StringVar(&successTemplate, "success-template", defaultSuccessTemplate, "Go template printed for each updated formula; fields: .File, .Repo, .OldVersion, .Version, .Platforms")
+	rootCmd.Flags().StringVar(&failureTemplate, "failure-template", "", "Go template printed for each formula that failed; fields as --success-template, plus .Error")
+	rootCmd.Flags().BoolVar(&tapJSON, "tap-json", false, "Print a JSON report of each formula's current and latest version, without changing anything")
+	rootCmd.Flags().BoolVar(&outdatedOnly, "outdated-only", false, "With --tap-json, only report formulas that are not at the latest release")
+	rootCmd.Flags().BoolVar(&selftest, "selftest", false, "Run brewup end to end against bundled fixtures, without network access, and report whether it works")
+	rootCmd.Flags().MarkHidden("selftest")
+	rootCmd.Flags().StringVar(&format, "format", "text", "Output format (text, json, markdown, github)")
+	rootCmd.Flags().StringVar(&algo, "algo", "sha256", "Checksum algorithm ("+strings.Join(hashNames(), ", ")+")")
 }
 
 func Execute() {
@@ -43,116 +197,382 @@ func Execute() {
 	}
 }
 
-func updateFormula() error {
+func run(cmd *cobra.Command) error {
+	resetURLCache()
+	resetRekorLog()
+	bytesDownloaded.Store(0)
+	patch.Reset()
+	if err := validateVersionMap(versionMap); err != nil {
+		return fmt.Errorf("--version-map: %w", err)
+	}
+	if err := loadConfig(cmd.Flags()); err != nil {
+		return err
+	}
+
 	// Validate inputs
-	if !strings.HasPrefix(version, "v") {
+	if version != "" && !strings.HasPrefix(version, "v") {
 		return fmt.Errorf("version must start with 'v' (e.g., v1.0.5)")
 	}
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("formula file does not exist: %s", filePath)
+	var rng versionRange
+	if versionRangeStr != "" {
+		if version != "" {
+			return fmt.Errorf("--version and --version-range are mutually exclusive")
+		}
+		var err error
+		if rng, err = parseVersionRange(versionRangeStr); err != nil {
+			return err
+		}
+	}
+	if failIfUnchanged && check {
+		return fmt.Errorf("--fail-if-unchanged and --check are mutually exclusive: --check never changes files")
 	}
-
-	// Read the formula file
-	content, err := os.ReadFile(filePath)
+	if retries < 0 {
+		return fmt.Errorf("--retries must not be negative")
+	}
+	if maxRedirects < 0 {
+		return fmt.Errorf("--max-redirects must not be negative")
+	}
+	if diffContext < 0 {
+		return fmt.Errorf("--diff-context must not be negative")
+	}
+	if parallelChunks < 1 {
+		return fmt.Errorf("--parallel-chunks must be at least 1")
+	}
+	switch formulaEncoding {
+	case "bytes", "utf-8":
+	default:
+		return fmt.Errorf("unsupported --formula-encoding %q (supported: bytes, utf-8)", formulaEncoding)
+	}
+	if contextLinesInError < 0 {
+		return fmt.Errorf("--context-lines-in-error must not be negative")
+	}
+	if err := selectPlatforms(cmd.Flags()); err != nil {
+		return err
+	}
+	if err := checkPlatformOverrides(); err != nil {
+		return err
+	}
+	ignored = map[platform]bool{}
+	for _, token := range ignore {
+		p, err := parsePlatform(token)
+		if err != nil {
+			return fmt.Errorf("--ignore: %w", err)
+		}
+		ignored[p] = true
+	}
+	switch on404 {
+	case on404Error, on404Skip, on404Prune, on404Warn:
+	default:
+		return fmt.Errorf("unsupported --on-404 %q (supported: error, skip, prune, warn)", on404)
+	}
+	switch format {
+	case "text":
+	case "json", "markdown", "github":
+		logOut = os.Stderr
+	default:
+		return fmt.Errorf("unsupported --format %q (supported: text, json, markdown, github)", format)
+	}
+	if err := parseMessageTemplates(); err != nil {
+		return err
+	}
+	if showCfg {
+		return showConfig(os.Stdout, resolvedConfig(cmd.Flags()))
+	}
+	if verifyReproPath != "" {
+		return verifyReproLog(verifyReproPath)
+	}
+	if outdatedOnly && !tapJSON {
+		return fmt.Errorf("--outdated-only requires --tap-json")
+	}
+	if selftest {
+		return runSelftest(os.Stdout, cmd.Flags())
+	}
+	a, err := selectedHash()
 	if err != nil {
-		return fmt.Errorf("failed to read formula file: %w", err)
+		return err
+	}
+	if extraAlgos, err = extraHashes(a); err != nil {
+		return err
+	}
+	if verifyRekor {
+		for _, x := range append([]hashAlgo{a}, extraAlgos...) {
+			if x.name != "sha256" && x.name != "sha512" {
+				return fmt.Errorf("--verify-rekor requires sha256 or sha512 checksums, the digests Rekor indexes, not %s", x.name)
+			}
+		}
+	}
+	if concurrency, err = parseConcurrency(concurrencyFlag, len(platforms)); err != nil {
+		return err
+	}
+	if limitRate != "" {
+		rate, err := parseRate(limitRate)
+		if err != nil {
+			return err
+		}
+		downloadLimiter = &rateLimiter{bytesPerSec: rate}
 	}
-	originalContent := string(content)
 
-	// Update version
-	versionRegex := regexp.MustCompile(`version\s+"v\d+\.\d+\.\d+"`)
-	newVersion := fmt.Sprintf(`version "%s"`, version)
-	updatedContent := versionRegex.ReplaceAllString(originalContent, newVersion)
+	files, err := formulaFiles()
+	if err != nil {
+		return err
+	}
+	if tapJSON {
+		return tapReport(os.Stdout, files, rng)
+	}
+	if len(files) == 0 {
+		logln("No changed formula files")
+		return printSummary(runSummary{})
+	}
 
-	// Define platforms and their binary names
-	platforms := []struct {
-		os   string
-		arch string
-	}{
-		{"darwin", "arm64"},
-		{"darwin", "amd64"},
-		{"linux", "arm64"},
-		{"linux", "amd64"},
+	var cp checkpoint
+	mode, request := checkpointMode(), checkpointRequest()
+	if resumeFromFile != "" {
+		if cp, err = loadCheckpoint(resumeFromFile); err != nil {
+			return err
+		}
 	}
 
-	// Update URLs and checksums for each platform
-	for _, p := range platforms {
-		binaryName := fmt.Sprintf("%s-%s-%s", repoName, p.os, p.arch)
-		newURL := fmt.Sprintf("https://github.com/interlynk-io/%s/releases/download/%s/%s", repoName, version, binaryName)
+	// Keep going past failures so every file shows up in the summary.
+	var summary runSummary
+	var lastErr error
+	failed := 0
+	for _, f := range files {
+		if e, ok := cp.done(f, mode, request); ok && checkpointCurrent(e, f, rng) {
+			logf("Skipping %s, completed in an earlier run (%s)\n", f, resumeFromFile)
+			summary.Formulas = append(summary.Formulas, e.Summary)
+			patch.WriteString(e.Patch)
+			continue
+		}
 
-		// Download binary and calculate checksum
-		checksum, err := calculateChecksum(newURL)
+		var res formulaSummary
+		patchStart := patch.Len()
+		switch {
+		case isScoopManifest(f) && check:
+			err = fmt.Errorf("--check is not supported for Scoop manifests")
+		case isScoopManifest(f):
+			res, err = updateScoop(f, a, rng)
+		case check:
+			res, err = checkFormula(f, a)
+		default:
+			res, err = updateFormula(f, a, rng)
+		}
+		res.File = f
 		if err != nil {
-			return fmt.Errorf("failed to calculate checksum for %s: %w", binaryName, err)
+			failed++
+			lastErr = fmt.Errorf("%s: %w", f, err)
+			res.Status = "failed"
+			res.Error = err.Error()
+			logMessage(failureTmpl, f, res)
+		} else if resumeFromFile != "" {
+			if err := cp.record(resumeFromFile, checkpointEntry{Mode: mode, Request: request, Summary: res, Patch: patch.String()[patchStart:]}); err != nil {
+				return err
+			}
 		}
-
-		// Update URL
-		urlRegex := regexp.MustCompile(fmt.Sprintf(`url "https://github\.com/interlynk-io/%s/releases/download/v\d+\.\d+\.\d+/%s",\s*:using\s*=>\s*:nounzip`, regexp.QuoteMeta(repoName), regexp.QuoteMeta(binaryName)))
-		updatedContent = urlRegex.ReplaceAllString(updatedContent, fmt.Sprintf(`url "%s", :using => :nounzip`, newURL))
-
-		// Update checksum
-		checksumRegex := regexp.MustCompile(fmt.Sprintf(`(url "%s",\s*:using\s*=>\s*:nounzip\n\s*sha256 ")[0-9a-f]{64}"`, regexp.QuoteMeta(newURL)))
-		updatedContent = checksumRegex.ReplaceAllString(updatedContent, fmt.Sprintf(`$1"%s"`, checksum))
+		summary.Formulas = append(summary.Formulas, res)
 	}
 
-	// Print changes (dry-run or log)
-	fmt.Printf("Changes to %s:\n", filePath)
-	fmt.Printf("Version: %s -> %s\n", versionRegex.FindString(originalContent), newVersion)
-	for _, p := range platforms {
-		binaryName := fmt.Sprintf("%s-%s-%s", repoName, p.os, p.arch)
-		// oldURL := fmt.Sprintf("https://github.com/interlynk-io/%s/releases/download/v\\d+\\.\\d+\\.\\d+/%s", repoName, binaryName)
-		newURL := fmt.Sprintf("https://github.com/interlynk-io/%s/releases/download/%s/%s", repoName, version, binaryName)
+	summary.BytesDownloaded = bytesDownloaded.Load()
+	if err := printSummary(summary); err != nil {
+		return fmt.Errorf("failed to print summary: %w", err)
+	}
+	if reportBandwidth {
+		logf("Downloaded %s in total\n", formatBytes(summary.BytesDownloaded))
+	}
+	if reproLogPath != "" {
+		if err := writeReproLog(reproLogPath, summary, a); err != nil {
+			return err
+		}
+	}
+	if patchOut != "" && !check {
+		if err := writePatch(); err != nil {
+			return err
+		}
+	}
+	if failed == 1 {
+		return lastErr
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d formula files failed", failed, len(files))
+	}
 
-		// Extract old checksum
-		oldChecksumRegex := regexp.MustCompile(fmt.Sprintf(`(url "https://github\.com/interlynk-io/%s/releases/download/v\d+\.\d+\.\d+/%s",\s*:using\s*=>\s*:nounzip\n\s*sha256 ")[0-9a-f]{64}"`, regexp.QuoteMeta(repoName), regexp.QuoteMeta(binaryName)))
-		oldChecksumMatch := oldChecksumRegex.FindString(originalContent)
-		var oldChecksum string
-		if oldChecksumMatch != "" {
-			oldChecksum = regexp.MustCompile(`[0-9a-f]{64}`).FindString(oldChecksumMatch)
+	// Every file is done; a rerun should start over.
+	if resumeFromFile != "" {
+		if err := os.Remove(resumeFromFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove checkpoint: %w", err)
 		}
+	}
+	return nil
+}
 
-		// Extract new checksum
-		newChecksumRegex := regexp.MustCompile(fmt.Sprintf(`(url "%s",\s*:using\s*=>\s*:nounzip\n\s*sha256 ")[0-9a-f]{64}"`, regexp.QuoteMeta(newURL)))
-		newChecksumMatch := newChecksumRegex.FindString(updatedContent)
-		var newChecksum string
-		if newChecksumMatch != "" {
-			newChecksum = regexp.MustCompile(`[0-9a-f]{64}`).FindString(newChecksumMatch)
+// resetFlags puts every flag of flags back to its default and drops the
+// state earlier runs derived from them, so a run depends on nothing but
+// what it sets itself.
+func resetFlags(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		switch v := f.Value.(type) {
+		case pflag.SliceValue:
+			v.Replace(nil)
+		default:
+			// An empty map's default, "[]", doesn't parse as one.
+			if f.Value.Type() != "stringToString" {
+				f.Value.Set(f.DefValue)
+			}
 		}
+		f.Changed = false
+	})
+	// Once set, --version-map adds to its map rather than replacing it, so
+	// it must not be nil.
+	versionMap, cfg = map[string]string{}, config{}
+	platforms, ignored, extraAlgos = defaultPlatforms, map[platform]bool{}, nil
+	concurrency, downloadLimiter = autoConcurrency(len(platforms)), nil
+}
 
-		fmt.Printf("Checksum (%s-%s): %s -> %s\n", p.os, p.arch, oldChecksum, newChecksum)
+// formulaFiles returns the formula files to process: the --file flag, the
+// .rb files in --formula-dir, or the .rb files changed in the --changed git
+// range. --changed narrows either of the others to the files that changed.
+func formulaFiles() ([]string, error) {
+	if filePath != "" && formulaDir != "" {
+		return nil, fmt.Errorf("--file and --formula-dir are mutually exclusive")
 	}
 
-	// Write changes (unless dry-run)
-	if dryRun {
-		fmt.Println("Dry-run mode: No changes written to file")
-		fmt.Println("Updated content preview:")
-		fmt.Println(updatedContent)
-		return nil
+	var files []string
+	switch {
+	case filePath != "":
+		files = []string{filePath}
+	case formulaDir != "":
+		var err error
+		if files, err = discoverFormulas(formulaDir, recursive); err != nil {
+			return nil, err
+		}
+	case changed == "":
+		return nil, fmt.Errorf("one of --file, --formula-dir or --changed is required")
 	}
 
-	if err := os.WriteFile(filePath, []byte(updatedContent), 0o644); err != nil {
-		return fmt.Errorf("failed to write updated formula file: %w", err)
+	if changed == "" {
+		return files, nil
 	}
 
-	fmt.Printf("Successfully updated %s\n", filePath)
-	return nil
+	diff, err := changedFormulas(changed)
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		return diff, nil
+	}
+
+	// Process only the selected files that changed.
+	inDiff := map[string]bool{}
+	for _, f := range diff {
+		inDiff[filepath.Clean(f)] = true
+	}
+	var selected []string
+	for _, f := range files {
+		if inDiff[filepath.Clean(f)] {
+			selected = append(selected, f)
+		}
+	}
+	return selected, nil
 }
 
-func calculateChecksum(url string) (string, error) {
-	resp, err := http.Get(url)
+// discoverFormulas returns the .rb files in dir, descending into
+// subdirectories when recursive is set.
+func discoverFormulas(dir string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".rb") {
+			return nil
+		}
+		// With --formula-name, only that formula's file is wanted.
+		if formulaName != "" && d.Name() != formulaName+".rb" {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to download %s: %w", url, err)
+		return nil, fmt.Errorf("failed to read formula directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .rb files found in %s", dir)
+	}
+	return files, nil
+}
+
+// invalidUTF8Line returns the line number of the first invalid UTF-8
+// sequence in b.
+func invalidUTF8Line(b []byte) int {
+	line := 1
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			return line
+		}
+		if r == '\n' {
+			line++
+		}
+		b = b[size:]
 	}
-	defer resp.Body.Close()
+	return line
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download %s: status %s", url, resp.Status)
+// readFile reads formula files; --selftest replaces it to read its bundled
+// fixtures from memory.
+var readFile = os.ReadFile
+
+// readFormula reads a formula file and determines the repository its
+// binaries come from. --org and --repo take precedence over what the
+// formula's URLs reference.
+func readFormula(path string) (content string, pr project, err error) {
+	b, err := readFile(path)
+	if os.IsNotExist(err) {
+		return "", project{}, fmt.Errorf("formula file does not exist: %s", path)
 	}
+	if err != nil {
+		return "", project{}, fmt.Errorf("failed to read formula file: %w", err)
+	}
+	// Formulas are edited as bytes, so whatever isn't replaced, valid UTF-8
+	// or not, is written back as it was.
+	if formulaEncoding == "utf-8" && !utf8.Valid(b) {
+		return "", project{}, fmt.Errorf("formula file is not valid UTF-8 at line %d; pass --formula-encoding bytes to update it anyway", invalidUTF8Line(b))
+	}
+	content = string(b)
 
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, resp.Body); err != nil {
-		return "", fmt.Errorf("failed to compute checksum: %w", err)
+	pr, inferErr := inferProject(path, content)
+	if repoName != "" {
+		pr.repo = repoName
+	}
+	if orgName != "" {
+		pr.org = orgName
+	}
+	if pr.repo == "" {
+		return "", project{}, inferErr
+	}
+	if pr.org == "" {
+		pr.org = defaultOrg
 	}
 
-	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+	// Guard against pointing --formula-name or --repo/--org at the wrong
+	// formula file.
+	if formulaName != "" && !force {
+		want, got := formulaClass(formulaName), declaredClass(content)
+		if got != "" && got != want {
+			return "", project{}, fmt.Errorf("formula declares class %s, but --formula-name %s expects %s; pass --force to update it anyway", got, formulaName, want)
+		}
+	}
+	if (repoName != "" || orgName != "") && !force {
+		refs := referencedProjects(content)
+		if len(refs) > 0 && !slices.Contains(refs, pr) {
+			return "", project{}, fmt.Errorf("formula references %v, not %s; pass --force to update it anyway", refs, pr)
+		}
+	}
+	return content, pr, nil
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadFormulaMismatchedRepo(t *testing.T) {
+	path := copyExample(t, "sbomasm.rb")
+	oldRepo, oldOrg, oldForce := repoName, orgName, force
+	t.Cleanup(func() { repoName, orgName, force = oldRepo, oldOrg, oldForce })
+
+	tests := []struct {
+		org, repo string
+	}{
+		{"", "sbomqs"},
+		{"other-org", ""},
+		{"other-org", "sbomasm"},
+	}
+	for _, tt := range tests {
+		orgName, repoName, force = tt.org, tt.repo, false
+		_, _, err := readFormula(path)
+		if err == nil || !strings.Contains(err.Error(), "formula references [interlynk-io/sbomasm]") || !strings.Contains(err.Error(), "--force") {
+			t.Errorf("--org %q --repo %q: err = %v, want a mismatched repo error", tt.org, tt.repo, err)
+		}
+
+		force = true
+		_, pr, err := readFormula(path)
+		if err != nil {
+			t.Errorf("--org %q --repo %q --force: %v", tt.org, tt.repo, err)
+			continue
+		}
+		if want := (project{org: or(tt.org, "interlynk-io"), repo: or(tt.repo, "sbomasm")}); pr != want {
+			t.Errorf("--org %q --repo %q --force: project %s, want %s", tt.org, tt.repo, pr, want)
+		}
+	}
+
+	// The project the formula does reference is accepted.
+	orgName, repoName, force = "interlynk-io", "sbomasm", false
+	if _, _, err := readFormula(path); err != nil {
+		t.Errorf("matching --org and --repo: %v", err)
+	}
+}
+
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
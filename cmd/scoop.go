@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// scoopManifest is the subset of a Scoop manifest brewup updates. url may
+// be given at the top level or per architecture.
+type scoopManifest struct {
+	Version      string                       `json:"version"`
+	URL          string                       `json:"url"`
+	Hash         string                       `json:"hash"`
+	Architecture map[string]scoopArchitecture `json:"architecture"`
+}
+
+type scoopArchitecture struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+// releaseTagRegex matches the tag in a GitHub release download url,
+// including its --tag-prefix.
+func releaseTagRegex() *regexp.Regexp {
+	return regexp.MustCompile(`/releases/download/(` + regexp.QuoteMeta(tagPrefix) + `[^/]+)/`)
+}
+
+// isScoopManifest reports whether path should be updated as a Scoop
+// manifest rather than a Homebrew formula.
+func isScoopManifest(path string) bool {
+	return scoop || strings.HasSuffix(path, ".json")
+}
+
+// updateScoop updates a Scoop manifest's version and the url and hash of
+// each architecture for the new version. The file is edited in place
+// rather than re-encoded, so its formatting and key order survive.
+func updateScoop(path string, a hashAlgo, rng versionRange) (formulaSummary, error) {
+	originalContent, pr, err := readFormula(path)
+	if err != nil {
+		return formulaSummary{}, err
+	}
+
+	var m scoopManifest
+	if err := json.Unmarshal([]byte(originalContent), &m); err != nil {
+		return formulaSummary{}, fmt.Errorf("failed to parse Scoop manifest: %w", err)
+	}
+	summary := formulaSummary{Repo: pr.String(), OldVersion: m.Version}
+
+	rel, err := resolveRelease(pr, rng)
+	if err != nil {
+		return summary, err
+	}
+	tag := rel.TagName
+	summary.ReleaseName = rel.Name
+	summary.ReleaseURL = rel.HTMLURL
+	// Scoop versions conventionally drop the tag's "v"; follow the manifest.
+	newVersion := tagVersion(tag)
+	if !strings.HasPrefix(m.Version, "v") {
+		newVersion = strings.TrimPrefix(newVersion, "v")
+	}
+	summary.NewVersion = newVersion
+	if err := checkVersion(path, pr, m.Version, tag); err != nil {
+		return summary, err
+	}
+
+	// Collect the urls to update, keyed by architecture.
+	type entry struct {
+		arch, url, hash string
+	}
+	var entries []entry
+	if m.URL != "" {
+		entries = append(entries, entry{"", m.URL, m.Hash})
+	}
+	archs := make([]string, 0, len(m.Architecture))
+	for arch := range m.Architecture {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+	for _, arch := range archs {
+		if u := m.Architecture[arch]; u.URL != "" {
+			entries = append(entries, entry{arch, u.URL, u.Hash})
+		}
+	}
+	if len(entries) == 0 {
+		return summary, fmt.Errorf("Scoop manifest has no url to update")
+	}
+
+	logf("Changes to %s:\n", path)
+	updatedContent := originalContent
+	for _, e := range entries {
+		name := e.arch
+		if name == "" {
+			name = "url"
+		}
+
+		newURL, err := scoopURL(e.url, tag, m.Version, newVersion)
+		if err != nil {
+			return summary, fmt.Errorf("%s: %w", name, err)
+		}
+
+		// Download binary and calculate checksum
+		downloadURL, _, _ := strings.Cut(newURL, "#")
+		if err := checkAssetRepo(downloadURL, pr); err != nil {
+			return summary, fmt.Errorf("%s: %w", name, err)
+		}
+		ea, prefix, err := scoopHashAlgo(e.hash, a)
+		if err != nil {
+			return summary, fmt.Errorf("%s: %w", name, err)
+		}
+		checksum, err := calculateChecksum(downloadURL, ea, defaultDownloadOptions())
+		if err != nil {
+			return summary, fmt.Errorf("failed to calculate checksum for %s: %w", name, err)
+		}
+		if ea.isEmptyInput(checksum) {
+			return summary, fmt.Errorf("checksum for %s is the %s of empty input, the download from %s was empty", name, ea.name, redactURL(downloadURL))
+		}
+		if err := verifyRekorEntry(checksum, ea, logOut); err != nil {
+			return summary, fmt.Errorf("%s: %w", name, err)
+		}
+		newHash := prefix + checksum
+
+		updatedContent = replaceJSONString(updatedContent, "url", e.url, newURL)
+		if e.hash != "" {
+			updatedContent = replaceJSONString(updatedContent, "hash", e.hash, newHash)
+		}
+		logf("Checksum (%s): %s -> %s\n", name, e.hash, newHash)
+
+		status := "updated"
+		if e.hash == newHash {
+			status = "unchanged"
+		}
+		summary.Platforms = append(summary.Platforms, platformSummary{
+			Platform:    name,
+			URL:         redactURL(newURL),
+			OldChecksum: e.hash,
+			NewChecksum: newHash,
+			Status:      status,
+		})
+	}
+	updatedContent = replaceJSONString(updatedContent, "version", m.Version, newVersion)
+
+	logf("Version: %s -> %s\n", m.Version, newVersion)
+	summary.Status = "up to date"
+	if updatedContent != originalContent {
+		summary.Status = "updated"
+	} else if failIfUnchanged {
+		return summary, fmt.Errorf("already at %s: %w", newVersion, errUnchanged)
+	}
+
+	if patchOut != "" {
+		patch.WriteString(unifiedDiff(patchPath(path), originalContent, updatedContent, diffContext))
+		logf("Added the changes to %s to %s\n", path, patchOut)
+		return summary, nil
+	}
+	if dryRun {
+		logln("Dry-run mode: No changes written to file")
+		logln("Updated content preview:")
+		logln(updatedContent)
+		return summary, nil
+	}
+
+	if backup {
+		if err := writeBackup(path, originalContent); err != nil {
+			return summary, err
+		}
+	}
+	if err := os.WriteFile(path, []byte(updatedContent), 0o644); err != nil {
+		return summary, fmt.Errorf("failed to write updated Scoop manifest: %w", err)
+	}
+
+	logMessage(successTmpl, path, summary)
+	return summary, nil
+}
+
+// scoopHashAlgo returns the algorithm to hash a manifest entry with and the
+// prefix to write in front of the new hash. A hash with a prefix such as
+// "sha512:" keeps its algorithm. A bare hash is a sha256 to Scoop, so it is
+// replaced by an --algo hash, prefixed unless --algo is sha256.
+func scoopHashAlgo(hash string, a hashAlgo) (hashAlgo, string, error) {
+	if name, _, ok := strings.Cut(hash, ":"); ok {
+		ha, known := hashAlgos[strings.ToLower(name)]
+		if !known || (ha.name != "sha256" && ha.name != "sha512") {
+			return hashAlgo{}, "", fmt.Errorf("unsupported hash algorithm %q in the manifest", name)
+		}
+		return ha, name + ":", nil
+	}
+	switch a.name {
+	case "sha256":
+		return a, "", nil
+	case "sha512":
+		return a, a.name + ":", nil
+	}
+	return hashAlgo{}, "", fmt.Errorf("Scoop manifests take sha256 or sha512 hashes, not %s", a.name)
+}
+
+// scoopURL returns url moved to the release tag: the tag in the download
+// path, and any mention of the old version in the file name, are replaced.
+func scoopURL(url, tag, oldVersion, newVersion string) (string, error) {
+	m := releaseTagRegex().FindStringSubmatchIndex(url)
+	if m == nil {
+		return "", fmt.Errorf("url %s is not a GitHub release download", redactURL(url))
+	}
+	oldTag := url[m[2]:m[3]]
+	rest := url[m[1]:]
+	if oldVersion != "" {
+		rest = strings.ReplaceAll(rest, strings.TrimPrefix(oldVersion, "v"), strings.TrimPrefix(newVersion, "v"))
+	}
+	return url[:m[2]] + strings.Replace(url[m[2]:m[1]], oldTag, tag, 1) + rest, nil
+}
+
+// replaceJSONString replaces the value of every "key": "old" pair in a JSON
+// document with new.
+func replaceJSONString(content, key, old, new string) string {
+	re := regexp.MustCompile(`("` + regexp.QuoteMeta(key) + `"\s*:\s*)` + regexp.QuoteMeta(jsonQuote(old)))
+	return re.ReplaceAllString(content, "${1}"+strings.ReplaceAll(jsonQuote(new), "$", "$$"))
+}
+
+// jsonQuote encodes s as a JSON string the way manifests write them, without
+// escaping characters such as & that are only special in HTML.
+func jsonQuote(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
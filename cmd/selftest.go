@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// selftestProject is the repository the bundled fixtures download from.
+// Its downloads are answered by selftestTransport and never leave the
+// process.
+var selftestProject = project{org: "brewup", repo: "selftest"}
+
+// selftestTransport answers the downloads of the bundled fixtures with
+// generated content.
+type selftestTransport struct{}
+
+func (selftestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := selftestAssets()[req.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// selftestAssets returns the content of every asset the fixtures download,
+// by url, for versions v1.0.0 and v1.1.0.
+func selftestAssets() map[string]string {
+	assets := map[string]string{}
+	for _, tag := range []string{"v1.0.0", "v1.1.0"} {
+		for _, p := range platforms {
+			name := p.binaryName(selftestProject.repo)
+			assets[selftestProject.releaseURL(tag, name)] = name + " " + tag
+		}
+		assets[selftestSourceURL(tag)] = "source " + tag
+	}
+	return assets
+}
+
+func selftestSourceURL(tag string) string {
+	return fmt.Sprintf("https://github.com/%s/%s/archive/refs/tags/%s.tar.gz", selftestProject.org, selftestProject.repo, tag)
+}
+
+func selftestChecksum(url string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(selftestAssets()[url])))
+}
+
+// selftestFormula returns a fixture formula installing per-platform
+// binaries at tag.
+func selftestFormula(tag string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "class Selftest < Formula\n  version %q\n", tag)
+	for _, osName := range []string{"darwin", "linux"} {
+		block := map[string]string{"darwin": "on_macos", "linux": "on_linux"}[osName]
+		fmt.Fprintf(&b, "\n  %s do\n", block)
+		for _, p := range platforms {
+			if p.os != osName {
+				continue
+			}
+			url := selftestProject.releaseURL(tag, p.binaryName(selftestProject.repo))
+			cpu := map[string]string{"arm64": "arm?", "amd64": "intel?"}[p.arch]
+			fmt.Fprintf(&b, "    if Hardware::CPU.%s\n      url %q, :using => :nounzip\n      sha256 %q\n    end\n", cpu, url, selftestChecksum(url))
+		}
+		b.WriteString("  end\n")
+	}
+	fmt.Fprintf(&b, "\n  test do\n    assert_match %q, shell_output(\"#{bin}/selftest version\")\n  end\nend\n", tag)
+	return b.String()
+}
+
+// selftestSourceFormula returns a fixture formula building from the source
+// archive of tag.
+func selftestSourceFormula(tag string) string {
+	url := selftestSourceURL(tag)
+	return fmt.Sprintf("class Selftest < Formula\n  url %q\n  sha256 %q\n  version %q\nend\n", url, selftestChecksum(url), strings.TrimPrefix(tag, "v"))
+}
+
+// runSelftest updates and checks the bundled fixtures end to end, with
+// downloads answered and hashed in memory and formulas read from memory in
+// dry-run mode, and prints whether each step passed. Every flag in flags
+// is reset to its default first.
+func runSelftest(w io.Writer, flags *pflag.FlagSet) error {
+	// Run with the defaults, whatever else was passed.
+	resetFlags(flags)
+	dryRun, version, concurrency, hashInMemory = true, "v1.1.0", 2, true
+	defer func(read func(string) ([]byte, error), rt http.RoundTripper, log io.Writer) {
+		readFile, httpClient.Transport, logOut, hashInMemory = read, rt, log, false
+	}(readFile, httpClient.Transport, logOut)
+	a := hashAlgos["sha256"]
+
+	fixtures := map[string]string{
+		"selftest.rb":        selftestFormula("v1.0.0"),
+		"selftest-source.rb": selftestSourceFormula("v1.0.0"),
+	}
+	readFile = func(path string) ([]byte, error) {
+		if content, ok := fixtures[path]; ok {
+			return []byte(content), nil
+		}
+		return nil, fs.ErrNotExist
+	}
+	SetTransport(selftestTransport{})
+	logOut = io.Discard
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"check binary formula", func() error {
+			s, err := checkFormula("selftest.rb", a)
+			if err == nil && s.Status != "ok" {
+				err = fmt.Errorf("status %q, want ok", s.Status)
+			}
+			return err
+		}},
+		{"update binary formula", func() error {
+			s, err := updateFormula("selftest.rb", a, nil)
+			if err != nil {
+				return err
+			}
+			return selftestVerify(s, len(platforms))
+		}},
+		{"update source formula", func() error {
+			s, err := updateFormula("selftest-source.rb", a, nil)
+			if err != nil {
+				return err
+			}
+			return selftestVerify(s, 1)
+		}},
+		{"deterministic output", func() error {
+			// Verbose, so the concurrent downloads log too.
+			defer func(v bool) { logOut, deterministicOutput, verbose = io.Discard, false, v }(verbose)
+			deterministicOutput, verbose = true, true
+			var runs [3]bytes.Buffer
+			for i := range runs {
+				logOut = &runs[i]
+				if _, err := updateFormula("selftest.rb", a, nil); err != nil {
+					return err
+				}
+				if i > 0 && !bytes.Equal(runs[i].Bytes(), runs[0].Bytes()) {
+					return fmt.Errorf("output of run %d differs from run 1:\n%s\nvs\n%s", i+1, runs[i].String(), runs[0].String())
+				}
+			}
+			return nil
+		}},
+	}
+
+	failed := 0
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %v\n", step.name, err)
+			continue
+		}
+		fmt.Fprintf(w, "PASS %s\n", step.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("selftest: %d of %d steps failed", failed, len(steps))
+	}
+	fmt.Fprintln(w, "selftest passed")
+	return nil
+}
+
+// selftestVerify checks that an update moved every asset to v1.1.0 with
+// the checksum of its content.
+func selftestVerify(s formulaSummary, assets int) error {
+	if s.Status != "updated" || s.NewVersion != "v1.1.0" {
+		return fmt.Errorf("status %q at %s, want updated at v1.1.0", s.Status, s.NewVersion)
+	}
+	if len(s.Platforms) != assets {
+		return fmt.Errorf("%d assets updated, want %d", len(s.Platforms), assets)
+	}
+	for _, p := range s.Platforms {
+		if want := selftestChecksum(p.URL); p.NewChecksum != want || !strings.Contains(p.URL, "v1.1.0") {
+			return fmt.Errorf("%s: checksum %s from %s, want %s", p.Platform, p.NewChecksum, p.URL, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSelftestIgnoresFlags(t *testing.T) {
+	// Downloads are hashed in memory, so none may land in TMPDIR.
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	_, err := runBrewup(t, "--selftest",
+		"--version-map", "v1.1.0=9.9.9", "--parallel-chunks", "4", "--retries", "0",
+		"--timeout", "1ns", "--limit-rate", "1", "--expected-org-repo-in-asset",
+		"--version-check-command", "false", "--url-refresh-command", "false",
+		"--algo", "sha512", "--platforms-preset", "macos", "--checksums-url", "https://example.com/sums")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(tmp, "brewup-*")); len(left) > 0 {
+		t.Errorf("selftest downloaded into %v", left)
+	}
+}
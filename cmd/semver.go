@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed vMAJOR.MINOR.PATCH[-PRERELEASE] version.
+type semver struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// parseSemver parses a version with an optional leading "v".
+func parseSemver(s string) (semver, error) {
+	v, parts, err := parseVersionParts(s)
+	if err != nil {
+		return semver{}, err
+	}
+	if parts != 3 {
+		return semver{}, fmt.Errorf("invalid version %q, expected MAJOR.MINOR.PATCH", s)
+	}
+	return v, nil
+}
+
+// parseVersionParts parses a possibly partial version such as 1, 1.2 or
+// 1.2.3 and returns it along with the number of components given.
+func parseVersionParts(s string) (semver, int, error) {
+	core := strings.TrimPrefix(s, "v")
+	var v semver
+	if i := strings.IndexByte(core, '-'); i >= 0 {
+		core, v.pre = core[:i], core[i+1:]
+		if v.pre == "" {
+			return semver{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+	}
+
+	fields := strings.Split(core, ".")
+	if len(fields) > 3 {
+		return semver{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return semver{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+	if v.pre != "" && len(fields) != 3 {
+		return semver{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	return v, len(fields), nil
+}
+
+// compare returns -1, 0 or 1 as v is lower than, equal to or higher than w.
+// A pre-release sorts before the release it precedes.
+func (v semver) compare(w semver) int {
+	for _, d := range [][2]int{{v.major, w.major}, {v.minor, w.minor}, {v.patch, w.patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == w.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case w.pre == "":
+		return -1
+	case v.pre < w.pre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// versionConstraint is a single comparison such as >=1.2.0.
+type versionConstraint struct {
+	op string
+	v  semver
+}
+
+func (c versionConstraint) allows(v semver) bool {
+	n := v.compare(c.v)
+	switch c.op {
+	case ">=":
+		return n >= 0
+	case ">":
+		return n > 0
+	case "<=":
+		return n <= 0
+	case "<":
+		return n < 0
+	default:
+		return n == 0
+	}
+}
+
+// versionRange is an npm-style range: space-separated constraints that must
+// all hold. Each constraint is a caret (^1.2.0), tilde (~1.2.3), comparison
+// (>=1.2.0, <2.0.0) or exact version. Pre-releases never match.
+type versionRange []versionConstraint
+
+func parseVersionRange(s string) (versionRange, error) {
+	var r versionRange
+	for _, term := range strings.Fields(s) {
+		cs, err := parseRangeTerm(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version range %q: %w", s, err)
+		}
+		r = append(r, cs...)
+	}
+	if len(r) == 0 {
+		return nil, fmt.Errorf("invalid version range %q: empty", s)
+	}
+	return r, nil
+}
+
+func parseRangeTerm(term string) ([]versionConstraint, error) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(term, op); ok {
+			v, err := parseSemver(rest)
+			if err != nil {
+				return nil, err
+			}
+			return []versionConstraint{{op, v}}, nil
+		}
+	}
+
+	switch term[0] {
+	case '^', '~':
+		lo, parts, err := parseVersionParts(term[1:])
+		if err != nil {
+			return nil, err
+		}
+		if lo.pre != "" {
+			return nil, fmt.Errorf("pre-release %q not supported in ranges", term)
+		}
+		hi := semver{major: lo.major + 1}
+		switch {
+		case term[0] == '~' && parts > 1:
+			// ~1.2.3 and ~1.2 allow patch updates.
+			hi = semver{major: lo.major, minor: lo.minor + 1}
+		case term[0] == '^' && lo.major == 0 && parts > 1:
+			// ^0.2.3 allows patch updates; ^0.0.3 only itself.
+			hi = semver{minor: lo.minor + 1}
+			if lo.minor == 0 && parts == 3 {
+				hi = semver{patch: lo.patch + 1}
+			}
+		}
+		return []versionConstraint{{">=", lo}, {"<", hi}}, nil
+	}
+
+	v, err := parseSemver(term)
+	if err != nil {
+		return nil, err
+	}
+	return []versionConstraint{{"=", v}}, nil
+}
+
+func (r versionRange) allows(v semver) bool {
+	if v.pre != "" {
+		return false
+	}
+	for _, c := range r {
+		if !c.allows(v) {
+			return false
+		}
+	}
+	return true
+}
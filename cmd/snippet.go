@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// noMatchSnippet explains why no url block matched p: the line format
+// brewup expects, and the formula's lines around where the block was
+// expected, so formatting differences stand out. It points at the first
+// line naming p's binary, else the first release download url, else the
+// on_macos/on_linux block for p's os. Up to --context-lines-in-error lines
+// are shown on each side; with 0 it returns "".
+func noMatchSnippet(path, content string, pr project, p platform, a hashAlgo) string {
+	if contextLinesInError <= 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  expected: url %q, :using => :nounzip\n", pr.releaseURL("<version>", p.binaryName(pr.repo)))
+	fmt.Fprintf(&b, "  followed by: %s \"<checksum>\"\n", a.name)
+
+	lines := strings.Split(content, "\n")
+	at := -1
+	osBlock := "on_" + map[string]string{"darwin": "macos", "linux": "linux"}[p.os] + " do"
+	for _, want := range []string{"/" + p.binaryName(pr.repo), "/releases/download/", osBlock} {
+		for i, l := range lines {
+			if strings.Contains(l, want) {
+				at = i
+				break
+			}
+		}
+		if at >= 0 {
+			break
+		}
+	}
+	if at < 0 {
+		fmt.Fprintf(&b, "  %s has no line naming %s\n", path, p.binaryName(pr.repo))
+		return b.String()
+	}
+
+	from, to := max(0, at-contextLinesInError), min(len(lines)-1, at+contextLinesInError)
+	fmt.Fprintf(&b, "  %s:\n", path)
+	for i := from; i <= to; i++ {
+		marker := " "
+		if i == at {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "  %s %4d | %s\n", marker, i+1, lines[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sourceURLRegex matches the url line of a formula built from a GitHub
+// source archive, capturing the url and the version in it.
+var sourceURLRegex = regexp.MustCompile(`url "(https://github\.com/[^/"]+/[^/"]+/archive/(?:refs/tags/)?(v?\d+\.\d+\.\d+)\.(?:tar\.gz|zip))"`)
+
+// isSourceFormula reports whether a formula builds from a single source
+// archive instead of installing per-platform binaries.
+func isSourceFormula(content string) bool {
+	for _, l := range strings.Split(content, "\n") {
+		if platformBlockRegex.MatchString(l) || osBlockRegex.MatchString(l) {
+			return false
+		}
+	}
+	return len(formulaURLRegex.FindAllString(content, -1)) == 1 && sourceURLRegex.MatchString(content)
+}
+
+// sourceVersion returns the version a source formula is at: its version
+// line, mapped back to its tag as formulaVersion does, or the version in
+// its url when there is none.
+func sourceVersion(content string) string {
+	if m := versionRegex.FindStringSubmatch(content); m != nil {
+		return unmappedVersion(m[2])
+	}
+	if m := sourceURLRegex.FindStringSubmatch(content); m != nil {
+		return m[2]
+	}
+	return ""
+}
+
+// updateSource returns a source formula updated to tag: the archive url
+// moved to the new tag, its checksum and the version line. Versions are
+// written with or without the "v" as the formula already has them, or as
+// --version-map maps tag.
+func updateSource(content string, pr project, tag string, a hashAlgo, summary *formulaSummary) (string, error) {
+	m := sourceURLRegex.FindStringSubmatch(content)
+	oldURL, oldVersion := m[1], m[2]
+
+	newURL := strings.Replace(oldURL, "/"+oldVersion+".", "/"+versionLike(oldVersion, tag)+".", 1)
+
+	if err := checkAssetRepo(newURL, pr); err != nil {
+		return "", err
+	}
+
+	// Download archive and calculate checksum
+	checksum, err := calculateChecksum(newURL, a, defaultDownloadOptions())
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate checksum for %s: %w", redactURL(newURL), err)
+	}
+	if a.isEmptyInput(checksum) {
+		return "", fmt.Errorf("checksum of %s is the %s of empty input, the download was empty", redactURL(newURL), a.name)
+	}
+	if err := verifyRekorEntry(checksum, a, logOut); err != nil {
+		return "", fmt.Errorf("%s: %w", redactURL(newURL), err)
+	}
+	oldChecksum := sourceChecksum(content, oldURL, a)
+
+	// Update version, URL and checksum
+	newVersion := sourceVersionFor(summary.OldVersion, tag)
+	content = replaceVersionLine(content, func(old string) string {
+		newVersion = sourceVersionFor(old, tag)
+		return newVersion
+	})
+	content = strings.Replace(content, fmt.Sprintf(`url "%s"`, oldURL), fmt.Sprintf(`url "%s"`, newURL), 1)
+	checksumRegex := regexp.MustCompile(fmt.Sprintf(`(url "%s"\n\s*%s )"[0-9a-f]*"(%s)?`, regexp.QuoteMeta(newURL), a.name, checksumCommentPattern))
+	content = checksumRegex.ReplaceAllStringFunc(content, func(s string) string {
+		m := checksumRegex.FindStringSubmatch(s)
+		return m[1] + `"` + checksum + `"` + checksumComment(m[2], newURL)
+	})
+
+	logf("Version: %s -> %s\n", summary.OldVersion, newVersion)
+	logf("Checksum (source): %s -> %s\n", oldChecksum, checksum)
+	ps := platformSummary{Platform: "source", URL: redactURL(newURL), OldChecksum: oldChecksum, NewChecksum: checksum, Status: "updated"}
+	if oldChecksum == checksum {
+		ps.Status = "unchanged"
+	}
+	summary.Platforms = append(summary.Platforms, ps)
+	return content, nil
+}
+
+// sourceVersionFor returns the version line value for tag in a source
+// formula whose version is old: tag's --version-map entry, or tag like old.
+func sourceVersionFor(old, tag string) string {
+	if v := mappedVersion(tag); v != tag {
+		return v
+	}
+	return versionLike(old, tag)
+}
+
+// versionLike returns tag with or without its "v", like old.
+func versionLike(old, tag string) string {
+	if strings.HasPrefix(old, "v") {
+		return tag
+	}
+	return strings.TrimPrefix(tag, "v")
+}
+
+// sourceChecksum returns the checksum on the line following a source
+// formula's url "<url>" line.
+func sourceChecksum(content, url string, a hashAlgo) string {
+	re := regexp.MustCompile(fmt.Sprintf(`url "%s"\n\s*%s "([0-9a-f]{%d})"`, regexp.QuoteMeta(url), a.name, a.hexLen()))
+	if m := re.FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUpdateSourceVersionMap(t *testing.T) {
+	const archive = "/interlynk-io/sbomasm/archive/refs/tags/"
+	serveAssets(t, map[string]string{
+		archive + "v1.0.5.tar.gz": "source v1.0.5",
+		archive + "v1.0.6.tar.gz": "source v1.0.6",
+	})
+	path := copyExample(t, "sbomasm-source.rb")
+
+	if _, err := runBrewup(t, "-f", path, "-v", "v1.0.5", "--version-map", "v1.0.5=1.0.5_1", "--update-test-version"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`version "1.0.5_1"`, `url "https://github.com` + archive + `v1.0.5.tar.gz"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("formula has no %s:\n%s", want, b)
+		}
+	}
+
+	// The mapped version line is found and replaced by the next update,
+	// which reads it as v1.0.5, so the test block moves from 1.0.5 too.
+	log, err := runBrewup(t, "-f", path, "-v", "v1.0.6", "--version-map", "v1.0.5=1.0.5_1", "--update-test-version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log, "Version: v1.0.5 -> 1.0.6") {
+		t.Errorf("old version not mapped back to its tag:\n%s", log)
+	}
+	b, _ = os.ReadFile(path)
+	for _, want := range []string{`version "1.0.6"`, `assert_match "1.0.6"`} {
+		if !strings.Contains(string(b), want) || strings.Contains(string(b), "1.0.5") {
+			t.Errorf("formula has no %s, or still has 1.0.5:\n%s", want, b)
+		}
+	}
+}
+
+func TestUpdateSourceExpectedOrgRepo(t *testing.T) {
+	serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("downloaded %s", r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	path := copyExample(t, "sbomasm-source.rb")
+
+	_, err := runBrewup(t, "-f", path, "-v", "v1.0.5", "--org", "other-org", "--force", "--expected-org-repo-in-asset")
+	if err == nil || !strings.Contains(err.Error(), "does not contain other-org/sbomasm") {
+		t.Fatalf("err = %v, want the asset url check to fail", err)
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// tapFormula is one formula of the --tap-json report.
+type tapFormula struct {
+	Name           string `json:"name"`
+	File           string `json:"file"`
+	Repo           string `json:"repo,omitempty"`
+	CurrentVersion string `json:"current_version,omitempty"`
+	LatestVersion  string `json:"latest_version,omitempty"`
+	UpToDate       bool   `json:"up_to_date"`
+	Error          string `json:"error,omitempty"`
+}
+
+// tapReport writes a JSON array describing each formula's version against
+// its repository's latest release, without downloading or changing
+// anything. With --outdated-only, formulas that are up to date are left
+// out; ones that failed are kept, since they need looking at too.
+func tapReport(w io.Writer, files []string, rng versionRange) error {
+	report := []tapFormula{}
+	for _, f := range files {
+		entry := tapFormulaState(f, rng)
+		if outdatedOnly && entry.UpToDate {
+			continue
+		}
+		report = append(report, entry)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// tapFormulaState resolves the latest release of one formula.
+func tapFormulaState(path string, rng versionRange) tapFormula {
+	entry := tapFormula{Name: strings.TrimSuffix(filepath.Base(path), ".rb"), File: path}
+	if isScoopManifest(path) {
+		entry.Error = "Scoop manifests are not supported by --tap-json"
+		return entry
+	}
+
+	content, pr, err := readFormula(path)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.Repo = pr.String()
+	entry.CurrentVersion = formulaVersion(content)
+	if isSourceFormula(content) {
+		entry.CurrentVersion = sourceVersion(content)
+	}
+
+	rel, err := resolveRelease(pr, rng)
+	if err != nil {
+		entry.Error = fmt.Sprintf("failed to resolve the latest release: %v", err)
+		return entry
+	}
+	entry.LatestVersion = tagVersion(rel.TagName)
+	entry.UpToDate = strings.TrimPrefix(entry.CurrentVersion, "v") == strings.TrimPrefix(entry.LatestVersion, "v")
+	return entry
+}
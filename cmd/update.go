@@ -0,0 +1,512 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// updateFormula rewrites a formula for the new version.
+func updateFormula(path string, a hashAlgo, rng versionRange) (formulaSummary, error) {
+	// Read the formula file
+	originalContent, pr, err := readFormula(path)
+	if err != nil {
+		return formulaSummary{}, err
+	}
+	summary := formulaSummary{
+		Repo:       pr.String(),
+		OldVersion: formulaVersion(originalContent),
+	}
+
+	// Resolve the version
+	rel, err := resolveRelease(pr, rng)
+	if err != nil {
+		return summary, err
+	}
+	tag := tagVersion(rel.TagName)
+	summary.NewVersion = tag
+	summary.ReleaseName = rel.Name
+	summary.ReleaseURL = rel.HTMLURL
+
+	if isSourceFormula(originalContent) {
+		summary.OldVersion = sourceVersion(originalContent)
+	}
+	if err := checkVersion(path, pr, summary.OldVersion, rel.TagName); err != nil {
+		return summary, err
+	}
+
+	// Formulas without a platform matrix build from one source archive.
+	logf("Changes to %s:\n", path)
+	var updatedContent string
+	if isSourceFormula(originalContent) {
+		updatedContent, err = updateSource(originalContent, pr, tag, a, &summary)
+	} else {
+		updatedContent, err = updateBinaries(path, originalContent, pr, rel, a, &summary)
+	}
+	if err != nil {
+		return summary, err
+	}
+	if updateTest {
+		updatedContent = updateBlockVersion(updatedContent, testBlockRegex, summary.OldVersion, tag)
+	}
+	if updateCaveats {
+		updatedContent = updateBlockVersion(updatedContent, caveatsBlockRegex, summary.OldVersion, tag)
+	}
+	for _, name := range updateDepends {
+		var found bool
+		if updatedContent, found = updateDependsVersion(updatedContent, name, summary.OldVersion, tag); !found && summary.OldVersion != tag {
+			fmt.Fprintf(os.Stderr, "Warning: %s has no depends_on %q pinned to %s, leaving its dependencies unchanged\n", path, name, summary.OldVersion)
+		}
+	}
+	if canonical {
+		updatedContent = canonicalize(updatedContent, pr)
+	}
+
+	// Record one digest over all checksums. A digest written by an earlier
+	// run is kept up to date even without --release-digest.
+	summary.ReleaseDigest = releaseDigest(summary.Platforms)
+	if digestComment || hasDigestComment(originalContent) {
+		updatedContent = setDigestComment(updatedContent, summary.ReleaseDigest)
+		logf("Release digest: %s\n", summary.ReleaseDigest)
+	}
+
+	// Check that nothing but the project's own urls was touched.
+	if clobbered := clobberedURLs(originalContent, updatedContent, pr); len(clobbered) > 0 {
+		msg := fmt.Sprintf("changes to lines with URLs unrelated to %s:\n  %s", pr, strings.Join(clobbered, "\n  "))
+		if noClobber {
+			return summary, fmt.Errorf("%s\nnot writing the formula (--no-clobber-unrelated-urls)", msg)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", path, msg)
+	}
+
+	summary.Status = "up to date"
+	if updatedContent != originalContent {
+		summary.Status = "updated"
+	} else if failIfUnchanged {
+		return summary, fmt.Errorf("already at %s: %w", tag, errUnchanged)
+	}
+
+	// Collect the change as a patch instead of writing it
+	if patchOut != "" {
+		patch.WriteString(unifiedDiff(patchPath(path), originalContent, updatedContent, diffContext))
+		logf("Added the changes to %s to %s\n", path, patchOut)
+		return summary, nil
+	}
+
+	// Write changes (unless dry-run)
+	if dryRun {
+		logln("Dry-run mode: No changes written to file")
+		logln("Updated content preview:")
+		logln(updatedContent)
+		return summary, nil
+	}
+
+	if backup {
+		if err := writeBackup(path, originalContent); err != nil {
+			return summary, err
+		}
+	}
+	if err := os.WriteFile(path, []byte(updatedContent), 0o644); err != nil {
+		return summary, fmt.Errorf("failed to write updated formula file: %w", err)
+	}
+
+	if audit {
+		if err := auditFormula(path); err != nil {
+			return summary, err
+		}
+	}
+	if runTest {
+		if err := testFormula(path, originalContent); err != nil {
+			return summary, err
+		}
+	}
+
+	// Only once audit and test passed, as either may put the file back.
+	logMessage(successTmpl, path, summary)
+	return summary, nil
+}
+
+// errUnchanged is returned with --fail-if-unchanged for a file the run
+// leaves as it is, which in a pipeline that always bumps means the wrong
+// version was passed.
+var errUnchanged = errors.New("no changes to the file (--fail-if-unchanged)")
+
+// updateBinaries returns a formula with per-platform binaries updated to
+// rel: the version line and every platform's url and checksum.
+func updateBinaries(path, originalContent string, pr project, rel githubRelease, a hashAlgo, summary *formulaSummary) (string, error) {
+	// Compute every platform's checksum before touching the content, so a
+	// failure on one platform never leaves a partially updated formula.
+	updates, err := computeUpdates(originalContent, pr, rel, a)
+	if err != nil {
+		return "", err
+	}
+
+	// Update version, URLs and checksums
+	newVersion := mappedVersion(tagVersion(rel.TagName))
+	updatedContent := applyUpdates(originalContent, pr, newVersion, updates, a)
+
+	// Print changes (dry-run or log)
+	logf("Version: %s -> version \"%s\"\n", strings.TrimSpace(versionRegex.FindString(originalContent)), newVersion)
+	for _, u := range updates {
+		p := u.platform
+		oldURL, oldChecksum, matched := currentAsset(originalContent, pr, p, a)
+		if u.oldURL != "" {
+			oldURL, oldChecksum, matched = u.oldURL, checksumAt(originalContent, u.oldURL, a), true
+		}
+		ps := platformSummary{Platform: p.String(), URL: redactURL(u.url), OldChecksum: oldChecksum, BytesDownloaded: u.received}
+		if !matched && u.action == "" {
+			ps.Status = "missing"
+			logf("Checksum (%s): no url block found, skipping\n", p)
+			logf("%s", noMatchSnippet(path, originalContent, pr, p, a))
+			summary.Platforms = append(summary.Platforms, ps)
+			continue
+		}
+
+		switch u.action {
+		case actionIgnore:
+			ps.Status = "skipped"
+			logf("Checksum (%s): %s (ignored, left unchanged)\n", p, oldChecksum)
+		case on404Skip, on404Warn:
+			ps.Status = "skipped"
+			logf("Checksum (%s): %s (asset not found, left unchanged)\n", p, oldChecksum)
+		case on404Prune:
+			ps.Status = "pruned"
+			logf("Checksum (%s): %s (asset not found, block removed)\n", p, oldChecksum)
+		default:
+			newChecksum := checksumAt(updatedContent, u.url, a)
+			if newChecksum != u.checksum {
+				return "", fmt.Errorf("the url of %s was moved to %s, but its %s line could not be found to replace", p, redactURL(u.url), a.name)
+			}
+			ps.NewChecksum = newChecksum
+			ps.Status = "updated"
+			if oldChecksum == newChecksum {
+				ps.Status = "unchanged"
+			}
+			logf("Checksum (%s): %s -> %s\n", p, oldChecksum, newChecksum)
+
+			for _, x := range extraAlgos {
+				old, _ := blockChecksum(originalContent, oldURL, x)
+				sum, ok := blockChecksum(updatedContent, u.url, x)
+				if !ok {
+					return "", fmt.Errorf("the url block of %s has no %s line, though the config file's algorithms list it", p, x.name)
+				}
+				if old != sum {
+					ps.Status = "updated"
+				}
+				ps.OtherChecksums = append(ps.OtherChecksums, checksumSummary{Algorithm: x.name, OldChecksum: old, NewChecksum: sum})
+				logf("Checksum (%s, %s): %s -> %s\n", p, x.name, old, sum)
+			}
+		}
+		if reportBandwidth && verbose {
+			logf("Downloaded (%s): %s\n", p, formatBytes(u.received))
+		}
+		summary.Platforms = append(summary.Platforms, ps)
+	}
+	return updatedContent, nil
+}
+
+// checksumCommentPattern matches the provenance comment --checksum-comment
+// appends to a checksum line.
+const checksumCommentPattern = `[ \t]*# from [^\n]*`
+
+// checksumComment returns the comment to end a checksum line computed from
+// url with, given the comment the line has now. Existing comments are kept
+// up to date even without --checksum-comment, so they never point at an
+// old url.
+func checksumComment(existing, url string) string {
+	if !checksumComments && existing == "" {
+		return ""
+	}
+	return " # from " + url
+}
+
+// resolveRelease returns the release to update to: --version, the highest
+// release matching --version-range, or the latest release. Only releases
+// resolved through the GitHub API carry a name and URL. With --tag-prefix,
+// the latest release is the highest one carrying the prefix, since the
+// repository's latest release may belong to another subproject.
+func resolveRelease(pr project, rng versionRange) (githubRelease, error) {
+	switch {
+	case rng != nil:
+		return resolveVersionRange(pr, rng)
+	case version == "" && tagPrefix != "":
+		return resolveVersionRange(pr, nil)
+	case version == "":
+		return latestRelease(pr)
+	default:
+		return githubRelease{TagName: releaseTag(version)}, nil
+	}
+}
+
+// assetUpdate is the new url and checksum for one platform's binary.
+type assetUpdate struct {
+	platform platform
+	url      string
+	checksum string
+	extra    []string // checksums with extraAlgos, in order
+
+	// oldURL is the url the formula had for the platform, set when the
+	// asset was found with --asset-glob and its name may have changed.
+	oldURL string
+
+	// action is the --on-404 policy applied when the asset was missing,
+	// actionIgnore for platforms excluded with --ignore, or empty when the
+	// asset was downloaded.
+	action string
+
+	// received is the number of bytes downloaded for the platform.
+	received int64
+}
+
+// actionIgnore marks a platform excluded with --ignore.
+const actionIgnore = "ignore"
+
+// --on-404 policies.
+const (
+	on404Error = "error"
+	on404Skip  = "skip"
+	on404Prune = "prune"
+	on404Warn  = "warn"
+)
+
+// computeUpdates downloads the binary of every platform for a release and
+// returns their checksums, or reads them from --checksums-url when set.
+// Missing assets are handled according to --on-404. All platforms are
+// attempted, and the failures are reported together.
+func computeUpdates(content string, pr project, rel githubRelease, a hashAlgo) ([]assetUpdate, error) {
+	tag := rel.TagName
+	if (assetGlob != "" || requireAll) && rel.Assets == nil {
+		// --version skips the API; fetch the release for its asset listing.
+		var err error
+		if rel, err = releaseByTag(pr, tag); err != nil {
+			return nil, err
+		}
+	}
+	if requireAll {
+		if err := requireAllPlatforms(rel, pr); err != nil {
+			return nil, err
+		}
+	}
+
+	var manifest checksumManifest
+	var manifestURL string
+	switch {
+	case checksumsURL != "":
+		manifestURL = expandChecksumsURL(checksumsURL, pr, tag)
+		var err error
+		if manifest, err = fetchChecksumManifest(manifestURL, a); err != nil {
+			return nil, err
+		}
+	case assumeChecksums:
+		var err error
+		if manifest, manifestURL, err = discoverChecksumManifest(pr, tag, a); err != nil {
+			return nil, err
+		}
+		if manifest != nil {
+			logf("Using checksums file %s\n", redactURL(manifestURL))
+		} else {
+			logln("No checksums file found in the release, downloading each binary")
+		}
+	}
+
+	compute := func(p platform, log, warn io.Writer) (assetUpdate, error) {
+		binaryName := p.binaryName(pr.repo)
+		newURL := pr.releaseURL(tag, binaryName)
+		if ignored[p] {
+			return assetUpdate{platform: p, url: newURL, action: actionIgnore}, nil
+		}
+
+		var oldURL string
+		var err error
+		if assetGlob != "" {
+			var asset githubAsset
+			if asset, err = matchAsset(rel, pr, p, log); err == nil {
+				binaryName, newURL = asset.Name, asset.BrowserDownloadURL
+				if oldURL, err = formulaAssetURL(content, pr, p); err != nil {
+					return assetUpdate{}, err
+				}
+			}
+		}
+
+		if err == nil {
+			if err := checkAssetRepo(newURL, pr); err != nil {
+				return assetUpdate{}, fmt.Errorf("%s: %w", p, err)
+			}
+		}
+
+		// Download binary and calculate checksum
+		opts := downloadOptionsFor(p)
+		opts.log = log
+		var received int64
+		opts.received = &received
+		download := func() (string, []string, error) {
+			sums, err := calculateChecksums(newURL, append([]hashAlgo{a}, extraAlgos...), opts)
+			if err != nil {
+				return "", nil, err
+			}
+			return sums[0], sums[1:], nil
+		}
+		var checksum string
+		var extra []string
+		switch {
+		case err != nil:
+		case manifest != nil:
+			var ok bool
+			checksum, ok = manifest.lookup(binaryName)
+			switch {
+			case ok && len(extraAlgos) > 0:
+				// The checksums file only has --algo checksums.
+				extra, err = calculateChecksums(newURL, extraAlgos, opts)
+			case !ok && checksumsURL == "":
+				// A discovered checksums file may not list every binary.
+				checksum, extra, err = download()
+			case !ok:
+				err = fmt.Errorf("%s is not listed in %s: %w", binaryName, redactURL(manifestURL), errAssetNotFound)
+			}
+		default:
+			checksum, extra, err = download()
+		}
+		if errors.Is(err, errAssetNotFound) && on404 != on404Error {
+			if on404 == on404Warn {
+				fmt.Fprintf(warn, "Warning: %s not found, leaving %s unchanged\n", redactURL(newURL), p)
+			}
+			return assetUpdate{platform: p, url: newURL, action: on404}, nil
+		}
+		if err != nil {
+			return assetUpdate{}, fmt.Errorf("failed to calculate checksum for %s: %w", binaryName, err)
+		}
+		if a.isEmptyInput(checksum) {
+			return assetUpdate{}, emptyChecksumError(p, newURL, a)
+		}
+		if err := verifyRekorEntry(checksum, a, log); err != nil {
+			return assetUpdate{}, fmt.Errorf("%s: %w", binaryName, err)
+		}
+		for i, x := range extraAlgos {
+			if err := verifyRekorEntry(extra[i], x, log); err != nil {
+				return assetUpdate{}, fmt.Errorf("%s: %w", binaryName, err)
+			}
+		}
+		return assetUpdate{platform: p, url: newURL, checksum: checksum, extra: extra, oldURL: oldURL, received: received}, nil
+	}
+
+	// Download up to --concurrency platforms at a time, starting them in
+	// platform order: a slot is taken before each download is started, so
+	// --concurrency 1 downloads one after the other in that order. Results
+	// keep the platform order. With --deterministic-output, what each
+	// download logs is held back and printed in that order too, once all
+	// are done.
+	order := platformOrder()
+	updates := make([]assetUpdate, len(order))
+	errs := make([]error, len(order))
+	logs := make([]bytes.Buffer, len(order))
+	warns := make([]bytes.Buffer, len(order))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, p := range order {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, p platform) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var log, warn io.Writer = logOut, os.Stderr
+			if deterministicOutput {
+				log, warn = &logs[i], &warns[i]
+			}
+			updates[i], errs[i] = compute(p, log, warn)
+		}(i, p)
+	}
+	wg.Wait()
+	for i := range order {
+		logOut.Write(logs[i].Bytes())
+		os.Stderr.Write(warns[i].Bytes())
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// requireAllPlatforms checks the release's asset listing for the binary of
+// every platform not excluded with --ignore, before anything is downloaded.
+func requireAllPlatforms(rel githubRelease, pr project) error {
+	var missing []string
+	for _, p := range platformOrder() {
+		if ignored[p] {
+			continue
+		}
+		if assetGlob != "" {
+			if _, err := matchAsset(rel, pr, p, io.Discard); errors.Is(err, errAssetNotFound) {
+				missing = append(missing, p.key())
+			} else if err != nil {
+				return err
+			}
+			continue
+		}
+		if !slices.ContainsFunc(rel.Assets, func(a githubAsset) bool { return a.Name == p.binaryName(pr.repo) }) {
+			missing = append(missing, p.key())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("release %s has no asset for %s", rel.TagName, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// applyUpdates returns content with the version line replaced by newVersion
+// and each platform's url and checksum replaced by its update.
+func applyUpdates(content string, pr project, newVersion string, updates []assetUpdate, a hashAlgo) string {
+	content = replaceVersionLine(content, func(string) string { return newVersion })
+
+	for _, u := range updates {
+		binaryName := u.platform.binaryName(pr.repo)
+		switch u.action {
+		case actionIgnore, on404Skip, on404Warn:
+			continue
+		case on404Prune:
+			content = pruneBlock(content, pr, u.platform)
+			continue
+		}
+
+		// Update URL
+		if u.oldURL != "" {
+			// The asset name may have changed; rename it in the install
+			// line too, since Homebrew stages the download under its name.
+			content = strings.ReplaceAll(content, fmt.Sprintf(`url "%s"`, u.oldURL), fmt.Sprintf(`url "%s"`, u.url))
+			content = strings.ReplaceAll(content, fmt.Sprintf(`"%s"`, path.Base(u.oldURL)), fmt.Sprintf(`"%s"`, path.Base(u.url)))
+		}
+		urlRegex := regexp.MustCompile(fmt.Sprintf(`url "https://github\.com/%s/%s/releases/download/%s/%s"(%s)`, regexp.QuoteMeta(pr.org), regexp.QuoteMeta(pr.repo), tagPattern(), regexp.QuoteMeta(binaryName), nounzipPattern))
+		content = urlRegex.ReplaceAllStringFunc(content, func(s string) string {
+			if urlRegex.FindStringSubmatch(s)[1] == "" {
+				return fmt.Sprintf(`url "%s"`, u.url)
+			}
+			return fmt.Sprintf(`url "%s", :using => :nounzip`, u.url)
+		})
+
+		// Update checksum
+		checksumRegex := regexp.MustCompile(fmt.Sprintf(`(url "%s"%s\n\s*%s )"+[0-9a-f]*"(%s)?`, regexp.QuoteMeta(u.url), nounzipPattern, a.name, checksumCommentPattern))
+		if checksumFirst(content, u.url, a) {
+			beforeRegex := checksumBeforeRegex(regexp.QuoteMeta(u.url), a)
+			content = beforeRegex.ReplaceAllStringFunc(content, func(s string) string {
+				m := beforeRegex.FindStringSubmatch(s)
+				return m[1] + `"` + u.checksum + `"` + checksumComment(m[3], u.url) + m[4]
+			})
+		} else {
+			content = checksumRegex.ReplaceAllStringFunc(content, func(s string) string {
+				m := checksumRegex.FindStringSubmatch(s)
+				return m[1] + `"` + u.checksum + `"` + checksumComment(m[2], u.url)
+			})
+		}
+		for i, x := range extraAlgos {
+			content = blockChecksumRegex(u.url, x).ReplaceAllString(content, `${1}"`+u.extra[i]+`"`)
+		}
+	}
+	return content
+}
@@ -0,0 +1,18 @@
+class Sbomasm < Formula
+  desc "SBOM Assembler - Assembler & Edit for your SBOMs"
+  homepage "https://github.com/interlynk-io/sbomasm"
+  url "https://github.com/interlynk-io/sbomasm/archive/refs/tags/v1.0.4.tar.gz"
+  sha256 "5b2f2a8e3a4f7a0c8b1e6c3b9f4d2e1a0c7b6d5e4f3a2b1c0d9e8f7a6b5c4d3e"
+  version "1.0.4"
+  license "Apache-2.0"
+
+  depends_on "go" => :build
+
+  def install
+    system "go", "build", *std_go_args(ldflags: "-s -w -X main.Version=#{version}")
+  end
+
+  test do
+    assert_match "1.0.4", shell_output("#{bin}/sbomasm version")
+  end
+end
@@ -25,7 +25,7 @@ class Sbomasm < Formula
   on_macos do
     if Hardware::CPU.arm?
       url "https://github.com/interlynk-io/sbomasm/releases/download/v1.0.4/sbomasm-darwin-arm64", :using => :nounzip
-      sha256 ""df798139cc9f0d36a341684dc413b87e784990a82fa3db626dd7fc97ab64f193"
+      sha256 "df798139cc9f0d36a341684dc413b87e784990a82fa3db626dd7fc97ab64f193"
 
       def install
         bin.install "sbomasm-darwin-arm64" => "sbomasm"
@@ -33,7 +33,7 @@ class Sbomasm < Formula
     end
     if Hardware::CPU.intel?
       url "https://github.com/interlynk-io/sbomasm/releases/download/v1.0.4/sbomasm-darwin-amd64", :using => :nounzip
-      sha256 ""240ceccc69fadafeccfb85bd07f166148f91e5f87497ef688215b349c9076453"
+      sha256 "240ceccc69fadafeccfb85bd07f166148f91e5f87497ef688215b349c9076453"
 
       def install
         bin.install "sbomasm-darwin-amd64" => "sbomasm"
@@ -44,7 +44,7 @@ class Sbomasm < Formula
   on_linux do
     if Hardware::CPU.arm? && Hardware::CPU.is_64_bit?
       url "https://github.com/interlynk-io/sbomasm/releases/download/v1.0.4/sbomasm-linux-arm64", :using => :nounzip
-      sha256 ""d3af03ddce76ad4b6352cc6a4d27708eb9e77e2a3f150ecc7ba82a5506f795b9"
+      sha256 "d3af03ddce76ad4b6352cc6a4d27708eb9e77e2a3f150ecc7ba82a5506f795b9"
 
       def install
         bin.install "sbomasm-linux-arm64" => "sbomasm"
@@ -52,7 +52,7 @@ class Sbomasm < Formula
     end
     if Hardware::CPU.intel?
       url "https://github.com/interlynk-io/sbomasm/releases/download/v1.0.4/sbomasm-linux-amd64", :using => :nounzip
-      sha256 ""cc7dd98597b6b62ea2268907157c1ab374b3011f8b3f07e187e91e870dfa1442"
+      sha256 "cc7dd98597b6b62ea2268907157c1ab374b3011f8b3f07e187e91e870dfa1442"
 
       def install
         bin.install "sbomasm-linux-amd64" => "sbomasm"